@@ -2,9 +2,10 @@ module intel8080
 
 go 1.22.6
 
+require github.com/gen2brain/raylib-go/raylib v0.0.0-20240826113553-b4d0c52dc927
+
 require (
 	github.com/ebitengine/purego v0.7.1 // indirect
-	github.com/gen2brain/raylib-go/raylib v0.0.0-20240826113553-b4d0c52dc927 // indirect
 	golang.org/x/exp v0.0.0-20240823005443-9b4947da3948 // indirect
 	golang.org/x/sys v0.24.0 // indirect
 )
@@ -0,0 +1,18 @@
+; 8-bit multiply by repeated addition, HL = B * C
+	ORG 0100H
+start:	LXI SP, stack
+	LXI H, 0
+	MVI D, 0
+	MOV E, C
+	MOV A, B
+	ORA A
+	JZ done
+loop:	DAD D
+	DCR B
+	JNZ loop
+done:	SHLD product
+	HLT
+
+product: DW 0
+	DS 16
+stack:
@@ -2,15 +2,27 @@ package main
 
 import "fmt"
 import "os"
-import "io"
 import "math/bits"
 import "strings"
+import "image/color"
 //import "time"
 
+//indexes into cpu.regs
+const (
+	regA = iota
+	regB
+	regC
+	regD
+	regE
+	regH
+	regL
+)
+
 type cpu struct {
-	regs map[string]uint8 //a, b, c, d, e, h, l 8-bit registers
+	regs [7]uint8 //a, b, c, d, e, h, l 8-bit registers, indexed with regA...regL
 	//a, b, c, d, e, h, l uint8 //8-bit registers
 	pc, sp uint16 //special 16-bit registers
+	halted bool //set by HLT, the cpu waits for an interrupt
 	zero, sign, parity, carry, ac bool //flags (Z, S, P, CY, AC)
 	memory [65536]uint8 //64KB of memory (0x000-0x1FFF=ROM, 0x2000-0x23FF=RAM, 0x2400-0x3FFF=VRAM, 0x4000-0xFFFF=RAM Mirror)
 	
@@ -25,25 +37,65 @@ type cpu struct {
 	shiftReg2 uint8
 	shiftOffset uint8
 	controlFlag uint8
+	port1 uint8 //player 1 buttons, bits as read on input port 1
+	port2 uint8 //player 2 buttons and tilt, bits as read on input port 2
+	dipSwitches uint8 //DIP switch bits of input port 2, see dipSwitchBits
+	cocktail bool //cocktail cabinet: player 2 has their own controls and the screen flips on their turn
+	overlay []color.RGBA //colour of a lit pixel at every screen position, nil for black and white
+	framebuffer []color.RGBA //drawn by runFrame as the beam passes, nil when nothing is shown
+	videoCycles uint64 //the beam's clock, cycles from power on including any time spent halted
+	followsBeam bool //runFrame drives the cpu, so a replay counts the frames the beam finishes
+	port3Out, port5Out uint8 //last sound bits written, for edge detection
+	sound soundPlayer //nil when there is no sound
+	watchdogFrames int //frames since the last port 6 write
+	watchdogResets int
+	coinCount int //coin switch presses, the board has no coin counter output the game drives
+	coinSwitch bool //coin switch in the last frame, only presses are counted
+
+	callStack []callFrame //shadow call stack for backtraces
+	history [historySize]historyEntry //ring buffer of the last executed instructions for crash reports
+	historyPos int
+	historyCount int
+
+	//reverse execution state for the debugger, see rewind.go
+	timeline, timelineEnd uint64
+	snapshots []*snapshot
+	inputLog map[uint64]uint8
+	interruptLog map[uint64]uint8
+	replaying bool
+
+	profile *profiler //nil unless -profile was given
+	coverage *coverage //nil unless -coverage was given
+	romStart, romEnd int //memory range filled by the last loadRom
+
+	instructions, cycles, frames uint64 //totals for -stats
 }
 
 func (cpu *cpu) cpuInit() {
-	cpu.regs = map[string]uint8 {"a":0, "b":0, "c":0, "d":0, "e":0, "h":0, "l":0}
+	cpu.regs = [7]uint8{}
 }
 
 func (cpu *cpu) loadRom(romPath string, startAddr int) {
-	rom, err := os.Open(romPath)
-	if err != nil {
+	if err := cpu.readRom(romPath, startAddr); err != nil {
 		panic(err)
 	}
-	defer rom.Close()
+}
 
-	bytes, err := rom.Read(cpu.memory[startAddr:])
-	if err != nil && err != io.EOF {
-		panic(err)
+//loadRom for ROMs named by the user, a missing file or one that does not fit is an error
+func (cpu *cpu) readRom(romPath string, startAddr int) error {
+	rom, err := os.ReadFile(romPath)
+	if err != nil {
+		return err
 	}
+	if startAddr < 0 || startAddr + len(rom) > len(cpu.memory) {
+		return fmt.Errorf("%v: %v bytes do not fit in memory at %04X", romPath, len(rom), startAddr)
+	}
+	bytes := copy(cpu.memory[startAddr:], rom)
 
+	cpu.romStart = startAddr
+	cpu.romEnd = startAddr + bytes
 	fmt.Printf("%v bytes loaded into memory\n", bytes)
+	return nil
 }
 
 func (cpu *cpu) dumpMemory(filePath string) {
@@ -61,46 +113,90 @@ func (cpu *cpu) dumpMemory(filePath string) {
 	fmt.Printf("Memory dump to file: %v, wrote %v bytes\n", filePath, bytes)
 }
 
-func (cpu *cpu) updateFlagsNOC(value int16) {
-	cpu.zero = (value & 0xff) == 0;
-    cpu.sign = 0x80 == (value & 0x80);
-    cpu.parity = bits.OnesCount16(uint16((value & 0xff))) % 2 == 0; 
-    //cpu.carry = value < 0 || value > 0xff;
-    cpu.ac = cpu.carry;
+func (cpu *cpu) updateFlagsZSP(value uint8) {
+	cpu.zero = value == 0
+	cpu.sign = value & 0x80 != 0
+	cpu.parity = bits.OnesCount8(value) % 2 == 0
+}
+
+func (cpu *cpu) carryValue() uint8 {
+	if cpu.carry {
+		return 1
+	}
+	return 0
+}
+
+//returns a + value + carryIn and sets all flags, AC is the carry out of bit 3
+func (cpu *cpu) addA(value uint8, carryIn uint8) uint8 {
+	a := cpu.regs[regA]
+	result := uint16(a) + uint16(value) + uint16(carryIn)
+	cpu.carry = result > 0xFF
+	cpu.ac = (a & 0x0F) + (value & 0x0F) + carryIn > 0x0F
+	cpu.updateFlagsZSP(uint8(result))
+	return uint8(result)
+}
+
+//returns a - value - borrowIn and sets all flags, the 8080 subtracts by adding the complement
+//so AC is the carry out of bit 3 of a + ^value + !borrow and CY is the inverted carry (the borrow)
+func (cpu *cpu) subA(value uint8, borrowIn uint8) uint8 {
+	result := cpu.addA(^value, 1 - borrowIn)
+	cpu.carry = !cpu.carry
+	return result
+}
+
+//AND clears CY, AC is set from bit 3 of the operands (8080 behaviour, the 8085 always sets it)
+func (cpu *cpu) andA(value uint8) {
+	cpu.ac = (cpu.regs[regA] | value) & 0x08 != 0
+	cpu.carry = false
+	cpu.regs[regA] &= value
+	cpu.updateFlagsZSP(cpu.regs[regA])
 }
 
-func (cpu *cpu) updateFlagsNOCAC(value int16) {
-	cpu.zero = (value & 0xff) == 0;
-    cpu.sign = 0x80 == (value & 0x80);
-    cpu.parity = bits.OnesCount16(uint16((value & 0xff))) % 2 == 0; 
-    //cpu.carry = value < 0 || value > 0xff;
-    //cpu.ac = cpu.carry;
+//XOR and OR clear CY and AC
+func (cpu *cpu) xorA(value uint8) {
+	cpu.ac = false
+	cpu.carry = false
+	cpu.regs[regA] ^= value
+	cpu.updateFlagsZSP(cpu.regs[regA])
 }
 
-func (cpu *cpu) updateFlagsOC(value int16) {
-	//cpu.zero = (value & 0xff) == 0;
-    //cpu.sign = 0x80 == (value & 0x80);
-    //cpu.parity = bits.OnesCount16(uint16((value & 0xff))) % 2 == 0; 
-    cpu.carry = value < 0 || value > 0xff;
-    //cpu.ac = cpu.carry;
+func (cpu *cpu) orA(value uint8) {
+	cpu.ac = false
+	cpu.carry = false
+	cpu.regs[regA] |= value
+	cpu.updateFlagsZSP(cpu.regs[regA])
 }
 
-func (cpu *cpu) updateFlags(value int16) {
-	cpu.zero = (value & 0xff) == 0;
-    cpu.sign = 0x80 == (value & 0x80);
-    cpu.parity = bits.OnesCount16(uint16((value & 0xff))) % 2 == 0; 
-    cpu.carry = value < 0 || value > 0xff;
-    cpu.ac = cpu.carry;
+//INR and DCR leave CY alone
+func (cpu *cpu) inc(value uint8) uint8 {
+	value++
+	cpu.ac = value & 0x0F == 0
+	cpu.updateFlagsZSP(value)
+	return value
+}
+
+func (cpu *cpu) dec(value uint8) uint8 {
+	value--
+	cpu.ac = value & 0x0F != 0x0F
+	cpu.updateFlagsZSP(value)
+	return value
+}
+
+//DAD only sets CY
+func (cpu *cpu) addHL(value uint16) {
+	result := uint32(cpu.get16BitReg("hl")) + uint32(value)
+	cpu.carry = result > 0xFFFF
+	cpu.load16BitReg("hl", uint16(result))
 }
 
 func (cpu *cpu) get16BitReg(pair string) uint16 {
 	switch pair {
 		case "bc":
-			return uint16(cpu.regs["b"]) << 8 | uint16(cpu.regs["c"])
+			return uint16(cpu.regs[regB]) << 8 | uint16(cpu.regs[regC])
 		case "de":
-			return uint16(cpu.regs["d"]) << 8 | uint16(cpu.regs["e"])
+			return uint16(cpu.regs[regD]) << 8 | uint16(cpu.regs[regE])
 		case "hl":
-			return uint16(cpu.regs["h"]) << 8 | uint16(cpu.regs["l"])
+			return uint16(cpu.regs[regH]) << 8 | uint16(cpu.regs[regL])
 		default:
 			return 0
 	}
@@ -109,96 +205,101 @@ func (cpu *cpu) get16BitReg(pair string) uint16 {
 func (cpu *cpu) load16BitReg(pair string, value uint16) {
 	switch pair {
 		case "bc":
-			cpu.regs["b"] = uint8(value >> 8)
-			cpu.regs["c"] = uint8(value & 0xFF)
+			cpu.regs[regB] = uint8(value >> 8)
+			cpu.regs[regC] = uint8(value & 0xFF)
 		case "de":
-			cpu.regs["d"] = uint8(value >> 8)
-			cpu.regs["e"] = uint8(value & 0xFF)
+			cpu.regs[regD] = uint8(value >> 8)
+			cpu.regs[regE] = uint8(value & 0xFF)
 		case "hl":
-			cpu.regs["h"] = uint8(value >> 8)
-			cpu.regs["l"] = uint8(value & 0xFF)
+			cpu.regs[regH] = uint8(value >> 8)
+			cpu.regs[regL] = uint8(value & 0xFF)
 	}
 }
 
+//small enough to be inlined, so with -d off an instruction pays for a bool check and nothing else
 func (cpu *cpu) trace(bytes int, mnemonic string) {
 	if debug {
-	    var ct, pt, st, zt int
-	    if cpu.carry {
-	        ct = 1
-	    } else {
-	        ct = 0
-	    }
-	    if cpu.parity {
-	        pt = 1
-	    } else {
-	        pt = 0
-	    }
-	    if cpu.sign {
-	        st = 1
-	    } else {
-	        st = 0
-	    }
-	    if cpu.zero {
-	        zt = 1
-	    } else {
-	        zt = 0
-	    }
+		cpu.printTrace(bytes, mnemonic)
+	}
+}
 
-	    mnemonic = strings.ReplaceAll(mnemonic, "d8", fmt.Sprintf("%X", cpu.byte2))
-	    mnemonic = strings.ReplaceAll(mnemonic, "d16", fmt.Sprintf("%X%X", cpu.byte3, cpu.byte2))
-	    mnemonic = strings.ReplaceAll(mnemonic, "addr", fmt.Sprintf("%X%X", cpu.byte3, cpu.byte2))
-	    mnemonic = strings.ReplaceAll(mnemonic, "a", fmt.Sprintf("%X", cpu.regs["a"]))
-	    mnemonic = strings.ReplaceAll(mnemonic, "b", fmt.Sprintf("%X", cpu.regs["b"]))
-	    mnemonic = strings.ReplaceAll(mnemonic, "c", fmt.Sprintf("%X", cpu.regs["c"]))
-	    mnemonic = strings.ReplaceAll(mnemonic, "d", fmt.Sprintf("%X", cpu.regs["d"]))
-	    mnemonic = strings.ReplaceAll(mnemonic, "e", fmt.Sprintf("%X", cpu.regs["e"]))
-	    mnemonic = strings.ReplaceAll(mnemonic, "h", fmt.Sprintf("%X", cpu.regs["h"]))
-	    mnemonic = strings.ReplaceAll(mnemonic, "l", fmt.Sprintf("%X", cpu.regs["l"]))
-	    mnemonic = strings.ReplaceAll(mnemonic, "pc", fmt.Sprintf("%X", cpu.pc))
-	    mnemonic = strings.ReplaceAll(mnemonic, "sp", fmt.Sprintf("%X", cpu.sp))
+func (cpu *cpu) printTrace(bytes int, mnemonic string) {
+	var ct, pt, st, zt int
+	if cpu.carry {
+	    ct = 1
+	} else {
+	    ct = 0
+	}
+	if cpu.parity {
+	    pt = 1
+	} else {
+	    pt = 0
+	}
+	if cpu.sign {
+	    st = 1
+	} else {
+	    st = 0
+	}
+	if cpu.zero {
+	    zt = 1
+	} else {
+	    zt = 0
+	}
+
+	mnemonic = strings.ReplaceAll(mnemonic, "d8", fmt.Sprintf("%X", cpu.byte2))
+	mnemonic = strings.ReplaceAll(mnemonic, "d16", fmt.Sprintf("%X%X", cpu.byte3, cpu.byte2))
+	mnemonic = strings.ReplaceAll(mnemonic, "addr", fmt.Sprintf("%X%X", cpu.byte3, cpu.byte2))
+	mnemonic = strings.ReplaceAll(mnemonic, "a", fmt.Sprintf("%X", cpu.regs[regA]))
+	mnemonic = strings.ReplaceAll(mnemonic, "b", fmt.Sprintf("%X", cpu.regs[regB]))
+	mnemonic = strings.ReplaceAll(mnemonic, "c", fmt.Sprintf("%X", cpu.regs[regC]))
+	mnemonic = strings.ReplaceAll(mnemonic, "d", fmt.Sprintf("%X", cpu.regs[regD]))
+	mnemonic = strings.ReplaceAll(mnemonic, "e", fmt.Sprintf("%X", cpu.regs[regE]))
+	mnemonic = strings.ReplaceAll(mnemonic, "h", fmt.Sprintf("%X", cpu.regs[regH]))
+	mnemonic = strings.ReplaceAll(mnemonic, "l", fmt.Sprintf("%X", cpu.regs[regL]))
+	mnemonic = strings.ReplaceAll(mnemonic, "pc", fmt.Sprintf("%X", cpu.pc))
+	mnemonic = strings.ReplaceAll(mnemonic, "sp", fmt.Sprintf("%X", cpu.sp))
 
-	    var bc uint16 = cpu.get16BitReg("bc")
-	    var de uint16 = cpu.get16BitReg("de")
-	    var hl uint16 = cpu.get16BitReg("hl")
+	var bc uint16 = cpu.get16BitReg("bc")
+	var de uint16 = cpu.get16BitReg("de")
+	var hl uint16 = cpu.get16BitReg("hl")
 
-	    switch bytes {
-	    case 1:
-	        fmt.Printf("A:%-2v C:%-2v P:%-2v S:%-2v Z:%-2v BC:%-4v DE:%-4v HL:%-4v SP:%-4v  %-4v %-4v %-4v %-4v %-9v\n",
-	            fmt.Sprintf("%X", cpu.regs["a"]),
-	            ct, pt, st, zt,
-	            fmt.Sprintf("%X", bc),
-	            fmt.Sprintf("%X", de),
-	            fmt.Sprintf("%X", hl),
-	            fmt.Sprintf("%X", cpu.sp),
-	            fmt.Sprintf("%X", cpu.pc),
-	            fmt.Sprintf("%X", cpu.opcode),
-	            "", "", mnemonic)
-	    case 2:
-	        fmt.Printf("A:%-2v C:%-2v P:%-2v S:%-2v Z:%-2v BC:%-4v DE:%-4v HL:%-4v SP:%-4v  %-4v %-4v %-4v %-4v %-9v\n",
-	            fmt.Sprintf("%X", cpu.regs["a"]),
-	            ct, pt, st, zt,
-	            fmt.Sprintf("%X", bc),
-	            fmt.Sprintf("%X", de),
-	            fmt.Sprintf("%X", hl),
-	            fmt.Sprintf("%X", cpu.sp),
-	            fmt.Sprintf("%X", cpu.pc),
-	            fmt.Sprintf("%X", cpu.opcode),
-	            fmt.Sprintf("%X", cpu.byte2),
-	            "", mnemonic)
-	    case 3:
-	        fmt.Printf("A:%-2v C:%-2v P:%-2v S:%-2v Z:%-2v BC:%-4v DE:%-4v HL:%-4v SP:%-4v  %-4v %-4v %-4v %-4v %-9v\n",
-	            fmt.Sprintf("%X", cpu.regs["a"]),
-	            ct, pt, st, zt,
-	            fmt.Sprintf("%X", bc),
-	            fmt.Sprintf("%X", de),
-	            fmt.Sprintf("%X", hl),
-	            fmt.Sprintf("%X", cpu.sp),
-	            fmt.Sprintf("%X", cpu.pc),
-	            fmt.Sprintf("%X", cpu.opcode),
-	            fmt.Sprintf("%X", cpu.byte2),
-	            fmt.Sprintf("%X", cpu.byte3),
-	            mnemonic)
-	    }
+	switch bytes {
+	case 1:
+	    fmt.Printf("A:%-2v C:%-2v P:%-2v S:%-2v Z:%-2v BC:%-4v DE:%-4v HL:%-4v SP:%-4v  %-4v %-4v %-4v %-4v %-9v\n",
+	        fmt.Sprintf("%X", cpu.regs[regA]),
+	        ct, pt, st, zt,
+	        fmt.Sprintf("%X", bc),
+	        fmt.Sprintf("%X", de),
+	        fmt.Sprintf("%X", hl),
+	        fmt.Sprintf("%X", cpu.sp),
+	        fmt.Sprintf("%X", cpu.pc),
+	        fmt.Sprintf("%X", cpu.opcode),
+	        "", "", mnemonic)
+	case 2:
+	    fmt.Printf("A:%-2v C:%-2v P:%-2v S:%-2v Z:%-2v BC:%-4v DE:%-4v HL:%-4v SP:%-4v  %-4v %-4v %-4v %-4v %-9v\n",
+	        fmt.Sprintf("%X", cpu.regs[regA]),
+	        ct, pt, st, zt,
+	        fmt.Sprintf("%X", bc),
+	        fmt.Sprintf("%X", de),
+	        fmt.Sprintf("%X", hl),
+	        fmt.Sprintf("%X", cpu.sp),
+	        fmt.Sprintf("%X", cpu.pc),
+	        fmt.Sprintf("%X", cpu.opcode),
+	        fmt.Sprintf("%X", cpu.byte2),
+	        "", mnemonic)
+	case 3:
+	    fmt.Printf("A:%-2v C:%-2v P:%-2v S:%-2v Z:%-2v BC:%-4v DE:%-4v HL:%-4v SP:%-4v  %-4v %-4v %-4v %-4v %-9v\n",
+	        fmt.Sprintf("%X", cpu.regs[regA]),
+	        ct, pt, st, zt,
+	        fmt.Sprintf("%X", bc),
+	        fmt.Sprintf("%X", de),
+	        fmt.Sprintf("%X", hl),
+	        fmt.Sprintf("%X", cpu.sp),
+	        fmt.Sprintf("%X", cpu.pc),
+	        fmt.Sprintf("%X", cpu.opcode),
+	        fmt.Sprintf("%X", cpu.byte2),
+	        fmt.Sprintf("%X", cpu.byte3),
+	        mnemonic)
 	}
 }
 
@@ -207,25 +308,25 @@ func (cpu *cpu) NOP() int {
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) MOVR1R2(r1 string, r2 string) int {
+func (cpu *cpu) MOVR1R2(r1 int, r2 int) int {
 	cycle := 5
 	cpu.regs[r1] = cpu.regs[r2]
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) MOVRM(r string) int {
+func (cpu *cpu) MOVRM(r int) int {
 	cycle := 7
 	cpu.regs[r] = cpu.memory[cpu.get16BitReg("hl")]
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) MOVMR(r string) int {
+func (cpu *cpu) MOVMR(r int) int {
 	cycle := 7
 	cpu.memory[cpu.get16BitReg("hl")] = cpu.regs[r]
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) MVIRD8(r string) int {
+func (cpu *cpu) MVIRD8(r int) int {
 	cycle := 7
 	cpu.regs[r] = cpu.byte2
 	cpu.pc += 2
@@ -237,7 +338,7 @@ func (cpu *cpu) MVIMD8() int {
 	cpu.pc += 2
 	return cycle
 }
-func (cpu *cpu) LXIRPD16(rh string, rl string) int {
+func (cpu *cpu) LXIRPD16(rh int, rl int) int {
 	cycle := 10
 	cpu.regs[rh] = cpu.byte3
 	cpu.regs[rl] = cpu.byte2
@@ -247,6 +348,7 @@ func (cpu *cpu) LXIRPD16(rh string, rl string) int {
 func (cpu *cpu) LXISPD16() int {
 	cycle := 10
 	cpu.sp = cpu.addr 	
+	cpu.trimCallStack()
 	cpu.pc += 3
 	return cycle
 }
@@ -256,15 +358,18 @@ func (cpu *cpu) CALL() int {
 	cpu.memory[cpu.sp - 1] = uint8(returnAddr >> 8)
 	cpu.memory[cpu.sp - 2] = uint8(returnAddr & 0xFF)
 	cpu.sp -= 2
+	cpu.pushCallFrame("CALL", cpu.addr, returnAddr)
 	cpu.pc = cpu.addr
 	return cycle
 }
 func (cpu *cpu) RET() int {
 	cycle := 10
+	retPC := cpu.pc
 	lowByte := uint16(cpu.memory[cpu.sp])
     highByte := uint16(cpu.memory[cpu.sp+1]) << 8
     cpu.pc = lowByte | highByte
     cpu.sp += 2
+    cpu.popCallFrame(retPC, cpu.sp - 2)
     return cycle
 }
 func (cpu *cpu) JMP() int {
@@ -274,11 +379,7 @@ func (cpu *cpu) JMP() int {
 }
 func (cpu *cpu) ANI() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) & int16(cpu.byte2)
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
-	//cpu.carry = false
-	//cpu.ac = false
+	cpu.andA(cpu.byte2)
 	cpu.pc += 2
 	return cycle
 }
@@ -293,68 +394,43 @@ func (cpu *cpu) JCON(flag bool, condition bool) int {
 }
 func (cpu *cpu) ADI() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) + int16(cpu.byte2)
-	cpu.regs["a"] = uint8(result & 0xFF)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.addA(cpu.byte2, 0)
 	cpu.pc += 2
 	return cycle
 }
 func (cpu *cpu) CPI() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) - int16(cpu.byte2)
-	cpu.updateFlags(result)
+	cpu.subA(cpu.byte2, 0)
 	cpu.pc += 2
 	return cycle
 }
 func (cpu *cpu) ACI() int {
 	cycle := 7
-	var cv uint8
-	if cpu.carry {
-		cv = 1
-	} else {
-		cv = 0
-	}
-	var result int16 = int16(cpu.regs["a"]) + int16(cpu.byte2) + int16(cv)
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.addA(cpu.byte2, cpu.carryValue())
 	cpu.pc += 2
 	return cycle
 }
 func (cpu *cpu) SUI() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) - int16(cpu.byte2)
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.subA(cpu.byte2, 0)
 	cpu.pc += 2
 	return cycle
 }
 func (cpu *cpu) SBI() int {
 	cycle := 7
-	var cv uint8
-	if cpu.carry {
-		cv = 1
-	} else {
-		cv = 0
-	}
-	var result int16 = int16(cpu.regs["a"]) - int16(cpu.byte2) - int16(cv)
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.subA(cpu.byte2, cpu.carryValue())
 	cpu.pc += 2
 	return cycle
 }
 func (cpu *cpu) ORI() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) | int16(cpu.byte2)
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.orA(cpu.byte2)
 	cpu.pc += 2
 	return cycle
 }
 func (cpu *cpu) XRI() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) ^ int16(cpu.byte2)
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.xorA(cpu.byte2)
 	cpu.pc += 2
 	return cycle
 }
@@ -365,6 +441,7 @@ func (cpu *cpu) CCON(flag bool) int {
 		cpu.memory[cpu.sp - 1] = uint8(returnAddr >> 8)
 		cpu.memory[cpu.sp - 2] = uint8(returnAddr & 0xFF)
 		cpu.sp -= 2
+		cpu.pushCallFrame("CALL", cpu.addr, returnAddr)
 		cpu.pc = cpu.addr
 	} else {
 		cycle = 11
@@ -376,199 +453,137 @@ func (cpu *cpu) CCON(flag bool) int {
 func (cpu *cpu) RCON(flag bool, condition bool) int {
 	cycle := 11
 	if flag == condition {
+		retPC := cpu.pc
 		lowByte := uint16(cpu.memory[cpu.sp])
         highByte := uint16(cpu.memory[cpu.sp+1]) << 8
         cpu.pc = lowByte | highByte
         cpu.sp += 2
+        cpu.popCallFrame(retPC, cpu.sp - 2)
 	} else {
 		cycle = 5
 		cpu.pc += 1
 	}
 	return cycle
 }
-func (cpu *cpu) INRR(r string) int {
+func (cpu *cpu) INRR(r int) int {
 	cycle := 5
-	var result int16 = int16(cpu.regs[r]) + int16(1)
-	cpu.regs[r] = uint8(result & 0xFF)
-	cpu.updateFlagsNOC(result)
+	cpu.regs[r] = cpu.inc(cpu.regs[r])
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) DCRR(r string) int {
+func (cpu *cpu) DCRR(r int) int {
 	cycle := 5
-	var result int16 = int16(cpu.regs[r]) - int16(1)
-	cpu.regs[r] = uint8(result & 0xFF)
-	cpu.updateFlagsNOC(result)
+	cpu.regs[r] = cpu.dec(cpu.regs[r])
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) XRAR(r string) int {
+func (cpu *cpu) XRAR(r int) int {
 	cycle := 4
-	var result int16 = int16(cpu.regs["a"]) ^ int16(cpu.regs[r])
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
-	//cpu.carry = false
-	//cpu.ac = false
+	cpu.xorA(cpu.regs[r])
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) ADDR(r string) int {
+func (cpu *cpu) ADDR(r int) int {
 	cycle := 4
-	var result int16 = int16(cpu.regs["a"]) + int16(cpu.regs[r])
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.addA(cpu.regs[r], 0)
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) SUBR(r string) int {
+func (cpu *cpu) SUBR(r int) int {
 	cycle := 4
-	var result int16 = int16(cpu.regs["a"]) - int16(cpu.regs[r])
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.subA(cpu.regs[r], 0)
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) ADCR(r string) int {
+func (cpu *cpu) ADCR(r int) int {
 	cycle := 4
-	var cv uint8
-	if cpu.carry {
-		cv = 1
-	} else {
-		cv = 0
-	}
-	var result int16 = int16(cpu.regs["a"]) + int16(cpu.regs[r]) + int16(cv)
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.addA(cpu.regs[r], cpu.carryValue())
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) SBBR(r string) int {
+func (cpu *cpu) SBBR(r int) int {
 	cycle := 4
-	var cv uint8
-	if cpu.carry {
-		cv = 1
-	} else {
-		cv = 0
-	}
-	var result int16 = int16(cpu.regs["a"]) - int16(cpu.regs[r]) - int16(cv)
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.subA(cpu.regs[r], cpu.carryValue())
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) ANAR(r string) int {
+func (cpu *cpu) ANAR(r int) int {
 	cycle := 4
-	var result int16 = int16(cpu.regs["a"]) & int16(cpu.regs[r])
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.andA(cpu.regs[r])
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) ORAR(r string) int {
+func (cpu *cpu) ORAR(r int) int {
 	cycle := 4
-	var result int16 = int16(cpu.regs["a"]) | int16(cpu.regs[r])
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.orA(cpu.regs[r])
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) CMPR(r string) int {
+func (cpu *cpu) CMPR(r int) int {
 	cycle := 4
-	var result int16 = int16(cpu.regs["a"]) - int16(cpu.regs[r])
-	cpu.updateFlags(result)
+	cpu.subA(cpu.regs[r], 0)
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) CMPM() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) - int16(cpu.memory[cpu.get16BitReg("hl")])
-	cpu.updateFlags(result)
+	cpu.subA(cpu.memory[cpu.get16BitReg("hl")], 0)
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) ADDM() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) + int16(cpu.memory[cpu.get16BitReg("hl")])
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.addA(cpu.memory[cpu.get16BitReg("hl")], 0)
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) SUBM() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) - int16(cpu.memory[cpu.get16BitReg("hl")])
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.subA(cpu.memory[cpu.get16BitReg("hl")], 0)
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) ADCM() int {
 	cycle := 7
-	var cv uint8
-	if cpu.carry {
-		cv = 1
-	} else {
-		cv = 0
-	}
-	var result int16 = int16(cpu.regs["a"]) + int16(cpu.memory[cpu.get16BitReg("hl")]) + int16(cv)
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.addA(cpu.memory[cpu.get16BitReg("hl")], cpu.carryValue())
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) SBBM() int {
 	cycle := 7
-	var cv uint8
-	if cpu.carry {
-		cv = 1
-	} else {
-		cv = 0
-	}
-	var result int16 = int16(cpu.regs["a"]) - int16(cpu.memory[cpu.get16BitReg("hl")]) - int16(cv)
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.regs[regA] = cpu.subA(cpu.memory[cpu.get16BitReg("hl")], cpu.carryValue())
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) ANAM() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) & int16(cpu.memory[cpu.get16BitReg("hl")])
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.andA(cpu.memory[cpu.get16BitReg("hl")])
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) ORAM() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) | int16(cpu.memory[cpu.get16BitReg("hl")])
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
+	cpu.orA(cpu.memory[cpu.get16BitReg("hl")])
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) XRAM() int {
 	cycle := 7
-	var result int16 = int16(cpu.regs["a"]) ^ int16(cpu.memory[cpu.get16BitReg("hl")])
-	cpu.regs["a"] = uint8(result)
-	cpu.updateFlags(result)
-	//cpu.carry = false
-	//cpu.ac = false
+	cpu.xorA(cpu.memory[cpu.get16BitReg("hl")])
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) INRM() int {
 	cycle := 10
-	var result int16 = int16(cpu.memory[cpu.get16BitReg("hl")]) + int16(1)
-	cpu.memory[cpu.get16BitReg("hl")] = uint8(result & 0xFF)
-	cpu.updateFlagsNOC(result)
+	addr := cpu.get16BitReg("hl")
+	cpu.memory[addr] = cpu.inc(cpu.memory[addr])
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) DCRM() int {
 	cycle := 10
-	var result int16 = int16(cpu.memory[cpu.get16BitReg("hl")]) - int16(1)
-	cpu.memory[cpu.get16BitReg("hl")] = uint8(result & 0xFF)
-	cpu.updateFlagsNOC(result)
+	addr := cpu.get16BitReg("hl")
+	cpu.memory[addr] = cpu.dec(cpu.memory[addr])
 	cpu.pc++
 	return cycle
 }
@@ -590,58 +605,56 @@ func (cpu *cpu) DCXRP(rp string) int {
 }
 func (cpu *cpu) STAADDR() int {
 	cycle := 13
-	cpu.memory[cpu.addr] = cpu.regs["a"]
+	cpu.memory[cpu.addr] = cpu.regs[regA]
 	cpu.pc += 3
 	return cycle
 }
 func (cpu *cpu) LDAADDR() int {
 	cycle := 13
-	cpu.regs["a"] = cpu.memory[cpu.addr]
+	cpu.regs[regA] = cpu.memory[cpu.addr]
 	cpu.pc += 3
 	return cycle
 }
 func (cpu *cpu) LHLDADDR() int {
 	cycle := 16
-	cpu.regs["l"] = cpu.memory[cpu.addr]
-	cpu.regs["h"] = cpu.memory[cpu.addr + 1]
+	cpu.regs[regL] = cpu.memory[cpu.addr]
+	cpu.regs[regH] = cpu.memory[cpu.addr + 1]
 	cpu.pc += 3
 	return cycle
 }
 func (cpu *cpu) SHLDADDR() int {
 	cycle := 16
-	cpu.memory[cpu.addr] = cpu.regs["l"]
-	cpu.memory[cpu.addr + 1] = cpu.regs["h"]
+	cpu.memory[cpu.addr] = cpu.regs[regL]
+	cpu.memory[cpu.addr + 1] = cpu.regs[regH]
 	cpu.pc += 3
 	return cycle
 }
 func (cpu *cpu) LDAXRP(rp string) int {
 	cycle := 7
-	cpu.regs["a"] = cpu.memory[cpu.get16BitReg(rp)]
+	cpu.regs[regA] = cpu.memory[cpu.get16BitReg(rp)]
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) STAXRP(rp string) int {
 	cycle := 7
-	cpu.memory[cpu.get16BitReg(rp)] = cpu.regs["a"]
+	cpu.memory[cpu.get16BitReg(rp)] = cpu.regs[regA]
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) XCHG() int {
-	cycle := 5
-	tempH := cpu.regs["h"]
-	tempL := cpu.regs["l"]
-	cpu.regs["h"] = cpu.regs["d"]
-	cpu.regs["l"] = cpu.regs["e"]
-	cpu.regs["d"] = tempH
-	cpu.regs["e"] = tempL
+	cycle := 4
+	tempH := cpu.regs[regH]
+	tempL := cpu.regs[regL]
+	cpu.regs[regH] = cpu.regs[regD]
+	cpu.regs[regL] = cpu.regs[regE]
+	cpu.regs[regD] = tempH
+	cpu.regs[regE] = tempL
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) DADRP(rp string) int {
-	cycle := 18
-	var result int16 = int16(cpu.get16BitReg("hl")) + int16(cpu.get16BitReg(rp))
-	cpu.load16BitReg("hl", uint16(result))
-	cpu.updateFlagsOC(result)
+	cycle := 10
+	cpu.addHL(cpu.get16BitReg(rp))
 	cpu.pc++
 	return cycle
 }
@@ -659,45 +672,46 @@ func (cpu *cpu) CMC() int {
 }
 func (cpu *cpu) CMA() int {
 	cycle := 4
-	cpu.regs["a"] = ^cpu.regs["a"]
+	cpu.regs[regA] = ^cpu.regs[regA]
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) DAA() int {
 	cycle := 4
-	accumulatorValue := cpu.regs["a"]
+	accumulatorValue := cpu.regs[regA]
+	var correction uint8 = 0
+	carry := cpu.carry
 
 	if (accumulatorValue & 0x0F) > 9 || cpu.ac {
-		accumulatorValue += 0x06
+		correction |= 0x06
 	}
-	if (accumulatorValue & 0xF0) > 0x90 || cpu.carry {
-		accumulatorValue += 0x60
-		cpu.carry = true // Set carry if adjustment causes it
+	if accumulatorValue > 0x99 || cpu.carry {
+		correction |= 0x60
+		carry = true //set carry if the high digit is adjusted, never cleared
 	}
 
-	cpu.regs["a"] = accumulatorValue
-	cpu.ac = (accumulatorValue & 0x0F) < 0x06
-	cpu.updateFlagsNOCAC(int16(accumulatorValue))
+	cpu.regs[regA] = cpu.addA(correction, 0)
+	cpu.carry = carry
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) RLC() int {
 	cycle := 4
-    accumulatorValue := cpu.regs["a"]
+    accumulatorValue := cpu.regs[regA]
     highOrderBit := (accumulatorValue & 0x80) >> 7
     rotatedValue := (accumulatorValue << 1) | highOrderBit
     cpu.carry = (highOrderBit == 1)
-    cpu.regs["a"] = rotatedValue
+    cpu.regs[regA] = rotatedValue
     cpu.pc++
     return cycle
 }
 func (cpu *cpu) RRC() int {
 	cycle := 4
-    accumulatorValue := cpu.regs["a"]
+    accumulatorValue := cpu.regs[regA]
     lowOrderBit := accumulatorValue & 0x01
     rotatedValue := (accumulatorValue >> 1) | (lowOrderBit << 7)
     cpu.carry = (lowOrderBit == 1)
-    cpu.regs["a"] = rotatedValue
+    cpu.regs[regA] = rotatedValue
     cpu.pc++
     return cycle
 }
@@ -710,10 +724,10 @@ func (cpu *cpu) RAL() int {
 		cy = 0
 	}
 
-    accumulatorValue := cpu.regs["a"]
+    accumulatorValue := cpu.regs[regA]
     rotatedValue := (accumulatorValue << 1) | cy
     cpu.carry = (accumulatorValue & 0x80) != 0
-    cpu.regs["a"] = rotatedValue
+    cpu.regs[regA] = rotatedValue
     cpu.pc++
     return cycle
 }
@@ -725,15 +739,15 @@ func (cpu *cpu) RAR() int {
 	} else {
 		cy = 0
 	}
-    accumulatorValue := cpu.regs["a"]
+    accumulatorValue := cpu.regs[regA]
     lowOrderBit := accumulatorValue & 0x01
     rotatedValue := (accumulatorValue >> 1) | (cy << 7)
     cpu.carry = (lowOrderBit == 1)
-    cpu.regs["a"] = rotatedValue
+    cpu.regs[regA] = rotatedValue
     cpu.pc ++
     return cycle
 }
-func (cpu *cpu) PUSHRP(rh string, rl string) int {
+func (cpu *cpu) PUSHRP(rh int, rl int) int {
 	cycle := 11
 	cpu.memory[cpu.sp - 1] = cpu.regs[rh]
 	cpu.memory[cpu.sp - 2] = cpu.regs[rl]
@@ -741,8 +755,8 @@ func (cpu *cpu) PUSHRP(rh string, rl string) int {
 	cpu.pc++
 	return cycle 
 }
-func (cpu *cpu) PUSHPSW() int {
-	cycle := 11
+//the flag byte as PUSH PSW stores it: S Z 0 AC 0 P 1 CY
+func (cpu *cpu) flagsByte() uint8 {
 	var flag uint8 = 0
 	if cpu.zero {
 		flag = flag | 0x40 //bit 6
@@ -760,28 +774,32 @@ func (cpu *cpu) PUSHPSW() int {
 		flag = flag | 0x10 //bit 4
 	}
 	flag = flag | 0x02 //bit 1 (always 1)
-	cpu.memory[cpu.sp - 2] = flag
-	cpu.memory[cpu.sp - 1] = cpu.regs["a"]
-	cpu.sp -= 2
-	cycle = 11
-	cpu.pc++
-	return cycle
+	return flag
 }
-func (cpu *cpu) POPPSW() int {
-	cycle := 10
-	flagByte := cpu.memory[cpu.sp]
+func (cpu *cpu) setFlagsByte(flagByte uint8) {
 	cpu.carry = (flagByte & 0x01) != 0    //bit 0
 	cpu.ac = (flagByte & 0x10) != 0       //bit 4
 	cpu.parity = (flagByte & 0x04) != 0   //bit 2
 	cpu.zero = (flagByte & 0x40) != 0     //bit 6
 	cpu.sign = (flagByte & 0x80) != 0     //bit 7
-	cpu.regs["a"] = cpu.memory[cpu.sp + 1]
+}
+func (cpu *cpu) PUSHPSW() int {
+	cycle := 11
+	cpu.memory[cpu.sp - 2] = cpu.flagsByte()
+	cpu.memory[cpu.sp - 1] = cpu.regs[regA]
+	cpu.sp -= 2
+	cpu.pc++
+	return cycle
+}
+func (cpu *cpu) POPPSW() int {
+	cycle := 10
+	cpu.setFlagsByte(cpu.memory[cpu.sp])
+	cpu.regs[regA] = cpu.memory[cpu.sp + 1]
 	cpu.sp += 2
-	cycle = 10
 	cpu.pc++
 	return cycle
 }
-func (cpu *cpu) POPRP(rh string, rl string) int {
+func (cpu *cpu) POPRP(rh int, rl int) int {
 	cycle := 10
 	cpu.regs[rl] = cpu.memory[cpu.sp]
 	cpu.regs[rh] = cpu.memory[cpu.sp + 1]
@@ -791,9 +809,7 @@ func (cpu *cpu) POPRP(rh string, rl string) int {
 }
 func (cpu *cpu) DADSP() int {
 	cycle := 10
-	var result int16 = int16(cpu.get16BitReg("hl")) + int16(cpu.sp)
-	cpu.load16BitReg("hl", uint16(result))
-	cpu.updateFlagsOC(result)
+	cpu.addHL(cpu.sp)
 	cpu.pc++
 	return cycle
 }
@@ -816,17 +832,19 @@ func (cpu *cpu) INXSP() int {
 func (cpu *cpu) SPHL() int {
 	cycle := 5
 	cpu.sp = cpu.get16BitReg("hl")
+	cpu.trimCallStack()
 	cpu.pc++
 	return cycle
 }
 func (cpu *cpu) XTHL() int {
 	cycle := 18
-	tempL := cpu.regs["l"]
-	tempH := cpu.regs["h"]
-	cpu.regs["l"] = cpu.memory[cpu.sp]
-	cpu.regs["h"] = cpu.memory[cpu.sp + 1]
+	tempL := cpu.regs[regL]
+	tempH := cpu.regs[regH]
+	cpu.regs[regL] = cpu.memory[cpu.sp]
+	cpu.regs[regH] = cpu.memory[cpu.sp + 1]
 	cpu.memory[cpu.sp] = tempL
 	cpu.memory[cpu.sp + 1] = tempH
+	cpu.swapCallFrameReturn()
 	cpu.pc++
 	return cycle
 }
@@ -835,6 +853,28 @@ func (cpu *cpu) PCHL() int {
 	cpu.pc = cpu.get16BitReg("hl")
 	return cycle
 }
+func (cpu *cpu) RST(n uint16) int {
+	cycle := 11
+	returnAddr := cpu.pc + 1
+	cpu.memory[cpu.sp - 1] = uint8(returnAddr >> 8)
+	cpu.memory[cpu.sp - 2] = uint8(returnAddr & 0xFF)
+	cpu.sp -= 2
+	cpu.pushCallFrame(fmt.Sprintf("RST %v", n), n * 8, returnAddr)
+	cpu.pc = n * 8
+	return cycle
+}
+func (cpu *cpu) DI() int {
+	cycle := 4
+	cpu.interruptEnable = false
+	cpu.pc++
+	return cycle
+}
+func (cpu *cpu) HLT() int {
+	cycle := 7
+	cpu.halted = true
+	cpu.pc++
+	return cycle
+}
 func (cpu *cpu) EI() int {
 	cycle := 4
 	cpu.interruptEnable = true
@@ -844,7 +884,14 @@ func (cpu *cpu) EI() int {
 func (cpu *cpu) IN() int {
 	cycle := 10
 	port := cpu.byte2
-	cpu.portsIN(port)
+	if debugger && cpu.behindPresent() {
+		cpu.regs[regA] = cpu.inputLog[cpu.timeline]
+	} else {
+		cpu.portsIN(port)
+		if debugger {
+			cpu.recordInput()
+		}
+	}
 	cpu.pc += 2
 	return cycle
 }
@@ -857,12 +904,25 @@ func (cpu *cpu) OUT() int {
 }
 
 func (cpu *cpu) executeInstruction() int {
+	if debugger && !cpu.replaying {
+		cpu.rewindHook()
+		cpu.debugHook()
+	}
+
 	cpu.opcode = cpu.memory[cpu.pc]
 	cpu.byte2 = cpu.memory[cpu.pc + 1]
 	cpu.byte3 = cpu.memory[cpu.pc + 2]
 	cpu.addr = uint16(cpu.memory[cpu.pc + 1]) | (uint16(cpu.memory[cpu.pc + 2]) << 8)
 	cycle := 0
 
+	cpu.recordHistory()
+	if cpu.profile != nil && !cpu.replaying {
+		cpu.profile.begin(cpu)
+	}
+	if cpu.coverage != nil && !cpu.replaying {
+		cpu.coverage.record(cpu)
+	}
+
 	//prevPC := cpu.pc
 
 	switch cpu.opcode {
@@ -976,385 +1036,385 @@ func (cpu *cpu) executeInstruction() int {
 			cycle = cpu.RCON(cpu.zero, false)
 		case 0x3E:
 			cpu.trace(2, "MVI (A)a, d8")
-			cycle = cpu.MVIRD8("a")
+			cycle = cpu.MVIRD8(regA)
 		case 0x3C:
 			cpu.trace(1, "INR (A)a")
-			cycle = cpu.INRR("a")
+			cycle = cpu.INRR(regA)
 		case 0x47:
 			cpu.trace(1, "MOV (B)b, (A)a")
-			cycle = cpu.MOVR1R2("b", "a")
+			cycle = cpu.MOVR1R2(regB, regA)
 		case 0x04:
 			cpu.trace(1, "INR (B)b")
-			cycle = cpu.INRR("b")
+			cycle = cpu.INRR(regB)
 		case 0x48:
 			cpu.trace(1, "MOV (C)c, (B)b")
-			cycle = cpu.MOVR1R2("c", "b")
+			cycle = cpu.MOVR1R2(regC, regB)
 		case 0x0D:
 			cpu.trace(1, "DCR (C)c")
-			cycle = cpu.DCRR("c")
+			cycle = cpu.DCRR(regC)
 		case 0x51:
 			cpu.trace(1, "MOV (D)d, (C)c")
-			cycle = cpu.MOVR1R2("d", "c")
+			cycle = cpu.MOVR1R2(regD, regC)
 		case 0x5A:
 			cpu.trace(1, "MOV (E)e, (D)d")
-			cycle = cpu.MOVR1R2("e", "d")
+			cycle = cpu.MOVR1R2(regE, regD)
 		case 0x63:
 			cpu.trace(1, "MOV (H)h, (E)e")
-			cycle = cpu.MOVR1R2("h", "e")
+			cycle = cpu.MOVR1R2(regH, regE)
 		case 0x6C:
 			cpu.trace(1, "MOV (L)l, (H)h")
-			cycle = cpu.MOVR1R2("l", "h")
+			cycle = cpu.MOVR1R2(regL, regH)
 		case 0x7D:
 			cpu.trace(1, "MOV (A)a, (L)l")
-			cycle = cpu.MOVR1R2("a", "l")
+			cycle = cpu.MOVR1R2(regA, regL)
 		case 0x3D:
 			cpu.trace(1, "DCR (A)a")
-			cycle = cpu.DCRR("a")
+			cycle = cpu.DCRR(regA)
 		case 0x4F:
 			cpu.trace(1, "MOV (C)c, (A)a")
-			cycle = cpu.MOVR1R2("c", "a")
+			cycle = cpu.MOVR1R2(regC, regA)
 		case 0x59:
 			cpu.trace(1, "MOV (E)e, (C)c")
-			cycle = cpu.MOVR1R2("e", "c")
+			cycle = cpu.MOVR1R2(regE, regC)
 		case 0x6B:
 			cpu.trace(1, "MOV (L)l, (E)e")
-			cycle = cpu.MOVR1R2("l", "e")
+			cycle = cpu.MOVR1R2(regL, regE)
 		case 0x45:
 			cpu.trace(1, "MOV (B)b, (L)l")
-			cycle = cpu.MOVR1R2("b", "l")
+			cycle = cpu.MOVR1R2(regB, regL)
 		case 0x50:
 			cpu.trace(1, "MOV (D)d, (B)b")
-			cycle = cpu.MOVR1R2("d", "b")
+			cycle = cpu.MOVR1R2(regD, regB)
 		case 0x62:
 			cpu.trace(1, "MOV (H)h, (D)d")
-			cycle = cpu.MOVR1R2("h", "d")
+			cycle = cpu.MOVR1R2(regH, regD)
 		case 0x7C:
 			cpu.trace(1, "MOV (A)a, (H)h")
-			cycle = cpu.MOVR1R2("a", "h")
+			cycle = cpu.MOVR1R2(regA, regH)
 		case 0x57:
 			cpu.trace(1, "MOV (D)d, (A)a")
-			cycle = cpu.MOVR1R2("d", "a")
+			cycle = cpu.MOVR1R2(regD, regA)
 		case 0x14:
 			cpu.trace(1, "INR (D)d")
-			cycle = cpu.INRR("d")
+			cycle = cpu.INRR(regD)
 		case 0x6A:
 			cpu.trace(1, "MOV (L)l, (D)d")
-			cycle = cpu.MOVR1R2("l", "d")
+			cycle = cpu.MOVR1R2(regL, regD)
 		case 0x4D:
 			cpu.trace(1, "MOV (C)c, (L)l")
-			cycle = cpu.MOVR1R2("c", "l")
+			cycle = cpu.MOVR1R2(regC, regL)
 		case 0x0C:
 			cpu.trace(1, "INR (C)c")
-			cycle = cpu.INRR("c")
+			cycle = cpu.INRR(regC)
 		case 0x61:
 			cpu.trace(1, "MOV (H)h, (C)c")
-			cycle = cpu.MOVR1R2("h", "c")
+			cycle = cpu.MOVR1R2(regH, regC)
 		case 0x44:
 			cpu.trace(1, "MOV (B)b, (H)h")
-			cycle = cpu.MOVR1R2("b", "h")
+			cycle = cpu.MOVR1R2(regB, regH)
 		case 0x05:
 			cpu.trace(1, "DCR (B)b")
-			cycle = cpu.DCRR("b")
+			cycle = cpu.DCRR(regB)
 		case 0x58:
 			cpu.trace(1, "MOV (E)e, (B)b")
-			cycle = cpu.MOVR1R2("e", "b")
+			cycle = cpu.MOVR1R2(regE, regB)
 		case 0x7B:
 			cpu.trace(1, "MOV (A)a, (E)e")
-			cycle = cpu.MOVR1R2("a", "e")
+			cycle = cpu.MOVR1R2(regA, regE)
 		case 0x5F:
 			cpu.trace(1, "MOV (E)e, (A)a")
-			cycle = cpu.MOVR1R2("e", "a")
+			cycle = cpu.MOVR1R2(regE, regA)
 		case 0x1C:
 			cpu.trace(1, "INR (E)e")
-			cycle = cpu.INRR("e")
+			cycle = cpu.INRR(regE)
 		case 0x43:
 			cpu.trace(1, "MOV (B)b, (E)e")
-			cycle = cpu.MOVR1R2("b", "e")
+			cycle = cpu.MOVR1R2(regB, regE)
 		case 0x60:
 			cpu.trace(1, "MOV (H)h, (B)b")
-			cycle = cpu.MOVR1R2("h", "b")
+			cycle = cpu.MOVR1R2(regH, regB)
 		case 0x24:
 			cpu.trace(1, "INR (H)h")
-			cycle = cpu.INRR("h")
+			cycle = cpu.INRR(regH)
 		case 0x4C:
 			cpu.trace(1, "MOV (C)c, (H)h")
-			cycle = cpu.MOVR1R2("c", "h")
+			cycle = cpu.MOVR1R2(regC, regH)
 		case 0x69:
 			cpu.trace(1, "MOV (L)l, (C)c")
-			cycle = cpu.MOVR1R2("l", "c")
+			cycle = cpu.MOVR1R2(regL, regC)
 		case 0x55:
 			cpu.trace(1, "MOV (D)d, (L)l")
-			cycle = cpu.MOVR1R2("d", "l")
+			cycle = cpu.MOVR1R2(regD, regL)
 		case 0x15:
 			cpu.trace(1, "DCR (D)d")
-			cycle = cpu.DCRR("d")
+			cycle = cpu.DCRR(regD)
 		case 0x7A:
 			cpu.trace(1, "MOV (A)a, (D)d")
-			cycle = cpu.MOVR1R2("a", "d")
+			cycle = cpu.MOVR1R2(regA, regD)
 		case 0x67:
 			cpu.trace(1, "MOV (H)h, (A)a")
-			cycle = cpu.MOVR1R2("h", "a")
+			cycle = cpu.MOVR1R2(regH, regA)
 		case 0x25:
 			cpu.trace(1, "DCR (H)h")
-			cycle = cpu.DCRR("h")
+			cycle = cpu.DCRR(regH)
 		case 0x54:
 			cpu.trace(1, "MOV (D)d, (H)h")
-			cycle = cpu.MOVR1R2("d", "h")
+			cycle = cpu.MOVR1R2(regD, regH)
 		case 0x42:
 			cpu.trace(1, "MOV (B)b, (D)d")
-			cycle = cpu.MOVR1R2("b", "d")
+			cycle = cpu.MOVR1R2(regB, regD)
 		case 0x68:
 			cpu.trace(1, "MOV (L)l, (B)b")
-			cycle = cpu.MOVR1R2("l", "b")
+			cycle = cpu.MOVR1R2(regL, regB)
 		case 0x2C:
 			cpu.trace(1, "INR (L)l")
-			cycle = cpu.INRR("l")
+			cycle = cpu.INRR(regL)
 		case 0x5D:
 			cpu.trace(1, "MOV (E)e, (L)l")
-			cycle = cpu.MOVR1R2("e", "l")
+			cycle = cpu.MOVR1R2(regE, regL)
 		case 0x1D:
 			cpu.trace(1, "DCR (E)e")
-			cycle = cpu.DCRR("e")
+			cycle = cpu.DCRR(regE)
 		case 0x4B:
 			cpu.trace(1, "MOV (C)c, (E)e")
-			cycle = cpu.MOVR1R2("c", "e")
+			cycle = cpu.MOVR1R2(regC, regE)
 		case 0x79:
 			cpu.trace(1, "MOV (A)a, (C)c")
-			cycle = cpu.MOVR1R2("a", "c")
+			cycle = cpu.MOVR1R2(regA, regC)
 		case 0x6F:
 			cpu.trace(1, "MOV (L)l, (A)a")
-			cycle = cpu.MOVR1R2("l", "a")
+			cycle = cpu.MOVR1R2(regL, regA)
 		case 0x2D:
 			cpu.trace(1, "DCR (L)l")
-			cycle = cpu.DCRR("l")
+			cycle = cpu.DCRR(regL)
 		case 0x65:
 			cpu.trace(1, "MOV (H)h, (L)l")
-			cycle = cpu.MOVR1R2("h", "l")
+			cycle = cpu.MOVR1R2(regH, regL)
 		case 0x5C:
 			cpu.trace(1, "MOV (E)e, (H)h")
-			cycle = cpu.MOVR1R2("e", "h")
+			cycle = cpu.MOVR1R2(regE, regH)
 		case 0x53:
 			cpu.trace(1, "MOV (D)d, (E)e")
-			cycle = cpu.MOVR1R2("d", "e")
+			cycle = cpu.MOVR1R2(regD, regE)
 		case 0x4A:
 			cpu.trace(1, "MOV (C)c, (D)d")
-			cycle = cpu.MOVR1R2("c", "d")
+			cycle = cpu.MOVR1R2(regC, regD)
 		case 0x41:
 			cpu.trace(1, "MOV (B)b, (C)c")
-			cycle = cpu.MOVR1R2("b", "c")
+			cycle = cpu.MOVR1R2(regB, regC)
 		case 0x78:
 			cpu.trace(1, "MOV (A)a, (B)b")
-			cycle = cpu.MOVR1R2("a", "b")
+			cycle = cpu.MOVR1R2(regA, regB)
 		case 0xAF:
 			cpu.trace(1, "XRA (A)a")
-			cycle = cpu.XRAR("a")
+			cycle = cpu.XRAR(regA)
 		case 0x06:
 			cpu.trace(1, "MVI (B)b, d8")
-			cycle = cpu.MVIRD8("b")
+			cycle = cpu.MVIRD8(regB)
 		case 0x0E:
 			cpu.trace(1, "MVI (C)c, d8")
-			cycle = cpu.MVIRD8("c")
+			cycle = cpu.MVIRD8(regC)
 		case 0x16:
 			cpu.trace(1, "MVI (D)d, d8")
-			cycle = cpu.MVIRD8("d")
+			cycle = cpu.MVIRD8(regD)
 		case 0x1E:
 			cpu.trace(1, "MVI (E)e, d8")
-			cycle = cpu.MVIRD8("e")
+			cycle = cpu.MVIRD8(regE)
 		case 0x26:
 			cpu.trace(1, "MVI (H)h, d8")
-			cycle = cpu.MVIRD8("h")
+			cycle = cpu.MVIRD8(regH)
 		case 0x2E:
 			cpu.trace(1, "MVI (L)l, d8")
-			cycle = cpu.MVIRD8("l")
+			cycle = cpu.MVIRD8(regL)
 		case 0x80:
 			cpu.trace(1, "ADD (B)b")
-			cycle = cpu.ADDR("b")
+			cycle = cpu.ADDR(regB)
 		case 0x81:
 			cpu.trace(1, "ADD (C)c")
-			cycle = cpu.ADDR("c")
+			cycle = cpu.ADDR(regC)
 		case 0x82:
 			cpu.trace(1, "ADD (D)d")
-			cycle = cpu.ADDR("d")
+			cycle = cpu.ADDR(regD)
 		case 0x83:
 			cpu.trace(1, "ADD (E)e")
-			cycle = cpu.ADDR("e")
+			cycle = cpu.ADDR(regE)
 		case 0x84:
 			cpu.trace(1, "ADD (H)h")
-			cycle = cpu.ADDR("h")
+			cycle = cpu.ADDR(regH)
 		case 0x85:
 			cpu.trace(1, "ADD (L)l")
-			cycle = cpu.ADDR("l")
+			cycle = cpu.ADDR(regL)
 		case 0x87:
 			cpu.trace(1, "ADD (A)a")
-			cycle = cpu.ADDR("a")
+			cycle = cpu.ADDR(regA)
 		case 0x90:
 			cpu.trace(1, "SUB (B)b")
-			cycle = cpu.SUBR("b")
+			cycle = cpu.SUBR(regB)
 		case 0x91:
 			cpu.trace(1, "SUB (C)c")
-			cycle = cpu.SUBR("c")
+			cycle = cpu.SUBR(regC)
 		case 0x92:
 			cpu.trace(1, "SUB (D)d")
-			cycle = cpu.SUBR("d")
+			cycle = cpu.SUBR(regD)
 		case 0x93:
 			cpu.trace(1, "SUB (E)e")
-			cycle = cpu.SUBR("e")
+			cycle = cpu.SUBR(regE)
 		case 0x94:
 			cpu.trace(1, "SUB (H)h")
-			cycle = cpu.SUBR("h")
+			cycle = cpu.SUBR(regH)
 		case 0x95:
 			cpu.trace(1, "SUB (L)l")
-			cycle = cpu.SUBR("l")
+			cycle = cpu.SUBR(regL)
 		case 0x97:
 			cpu.trace(1, "SUB (A)a")
-			cycle = cpu.SUBR("a")
+			cycle = cpu.SUBR(regA)
 		case 0x88:
 			cpu.trace(1, "ADC (B)b")
-			cycle = cpu.ADCR("b")
+			cycle = cpu.ADCR(regB)
 		case 0x89:
 			cpu.trace(1, "ADC (C)c")
-			cycle = cpu.ADCR("c")
+			cycle = cpu.ADCR(regC)
 		case 0x8A:
 			cpu.trace(1, "ADC (D)d")
-			cycle = cpu.ADCR("d")
+			cycle = cpu.ADCR(regD)
 		case 0x8B:
 			cpu.trace(1, "ADC (E)e")
-			cycle = cpu.ADCR("e")
+			cycle = cpu.ADCR(regE)
 		case 0x8C:
 			cpu.trace(1, "ADC (H)h")
-			cycle = cpu.ADCR("h")
+			cycle = cpu.ADCR(regH)
 		case 0x8D:
 			cpu.trace(1, "ADC (L)l")
-			cycle = cpu.ADCR("l")
+			cycle = cpu.ADCR(regL)
 		case 0x8F:
 			cpu.trace(1, "ADC (A)a")
-			cycle = cpu.ADCR("a")
+			cycle = cpu.ADCR(regA)
 		case 0x98:
 			cpu.trace(1, "SBB (B)b")
-			cycle = cpu.SBBR("b")
+			cycle = cpu.SBBR(regB)
 		case 0x99:
 			cpu.trace(1, "SBB (C)c")
-			cycle = cpu.SBBR("c")
+			cycle = cpu.SBBR(regC)
 		case 0x9A:
 			cpu.trace(1, "SBB (D)d")
-			cycle = cpu.SBBR("d")
+			cycle = cpu.SBBR(regD)
 		case 0x9B:
 			cpu.trace(1, "SBB (E)e")
-			cycle = cpu.SBBR("e")
+			cycle = cpu.SBBR(regE)
 		case 0x9C:
 			cpu.trace(1, "SBB (H)h")
-			cycle = cpu.SBBR("h")
+			cycle = cpu.SBBR(regH)
 		case 0x9D:
 			cpu.trace(1, "SBB (L)l")
-			cycle = cpu.SBBR("l")
+			cycle = cpu.SBBR(regL)
 		case 0x9F:
 			cpu.trace(1, "SBB (A)a")
-			cycle = cpu.SBBR("a")
+			cycle = cpu.SBBR(regA)
 		case 0xA7:
 			cpu.trace(1, "ANA (A)a")
-			cycle = cpu.ANAR("a")
+			cycle = cpu.ANAR(regA)
 		case 0xA1:
 			cpu.trace(1, "ANA (C)c")
-			cycle = cpu.ANAR("c")
+			cycle = cpu.ANAR(regC)
 		case 0xA2:
 			cpu.trace(1, "ANA (D)d")
-			cycle = cpu.ANAR("d")
+			cycle = cpu.ANAR(regD)
 		case 0xA3:
 			cpu.trace(1, "ANA (E)e")
-			cycle = cpu.ANAR("e")
+			cycle = cpu.ANAR(regE)
 		case 0xA4:
 			cpu.trace(1, "ANA (H)h")
-			cycle = cpu.ANAR("h")
+			cycle = cpu.ANAR(regH)
 		case 0xA5:
 			cpu.trace(1, "ANA (L)l")
-			cycle = cpu.ANAR("l")
+			cycle = cpu.ANAR(regL)
 		case 0xB0:
 			cpu.trace(1, "ORA (B)b")
-			cycle = cpu.ORAR("b")
+			cycle = cpu.ORAR(regB)
 		case 0xB1:
 			cpu.trace(1, "ORA (C)c")
-			cycle = cpu.ORAR("c")
+			cycle = cpu.ORAR(regC)
 		case 0xB2:
 			cpu.trace(1, "ORA (D)d")
-			cycle = cpu.ORAR("d")
+			cycle = cpu.ORAR(regD)
 		case 0xB3:
 			cpu.trace(1, "ORA (E)e")
-			cycle = cpu.ORAR("e")
+			cycle = cpu.ORAR(regE)
 		case 0xB4:
 			cpu.trace(1, "ORA (H)h")
-			cycle = cpu.ORAR("h")
+			cycle = cpu.ORAR(regH)
 		case 0xB5:
 			cpu.trace(1, "ORA (L)l")
-			cycle = cpu.ORAR("l")
+			cycle = cpu.ORAR(regL)
 		case 0xB7:
 			cpu.trace(1, "ORA (A)a")
-			cycle = cpu.ORAR("a")
+			cycle = cpu.ORAR(regA)
 		case 0xA8:
 			cpu.trace(1, "XRA (B)b")
-			cycle = cpu.XRAR("b")
+			cycle = cpu.XRAR(regB)
 		case 0xA9:
 			cpu.trace(1, "XRA (C)c")
-			cycle = cpu.XRAR("c")
+			cycle = cpu.XRAR(regC)
 		case 0xAA:
 			cpu.trace(1, "XRA (D)d")
-			cycle = cpu.XRAR("d")
+			cycle = cpu.XRAR(regD)
 		case 0xAB:
 			cpu.trace(1, "XRA (E)e")
-			cycle = cpu.XRAR("e")
+			cycle = cpu.XRAR(regE)
 		case 0xAC:
 			cpu.trace(1, "XRA (H)h")
-			cycle = cpu.XRAR("h")
+			cycle = cpu.XRAR(regH)
 		case 0xAD:
 			cpu.trace(1, "XRA (L)l")
-			cycle = cpu.XRAR("l")
+			cycle = cpu.XRAR(regL)
 		case 0x70:
 			cpu.trace(1, "MOV M, (B)b")
-			cycle = cpu.MOVMR("b")
+			cycle = cpu.MOVMR(regB)
 		case 0x46:
 			cpu.trace(1, "MOV (B)b, M")
-			cycle = cpu.MOVRM("b")
+			cycle = cpu.MOVRM(regB)
 		case 0xB8:
 			cpu.trace(1, "CMP (B)b")
-			cycle = cpu.CMPR("b")
+			cycle = cpu.CMPR(regB)
 		case 0x72:
 			cpu.trace(1, "MOV M, (D)d")
-			cycle = cpu.MOVMR("d")
+			cycle = cpu.MOVMR(regD)
 		case 0x56:
 			cpu.trace(1, "MOV (D)d, M")
-			cycle = cpu.MOVRM("d")
+			cycle = cpu.MOVRM(regD)
 		case 0xBA:
 			cpu.trace(1, "CMP (D)d")
-			cycle = cpu.CMPR("d")
+			cycle = cpu.CMPR(regD)
 		case 0x73:
 			cpu.trace(1, "MOV M, (E)e")
-			cycle = cpu.MOVMR("e")
+			cycle = cpu.MOVMR(regE)
 		case 0x5E:
 			cpu.trace(1, "MOV (E)e, M")
-			cycle = cpu.MOVRM("e")
+			cycle = cpu.MOVRM(regE)
 		case 0xBB:
 			cpu.trace(1, "CMP (E)e")
-			cycle = cpu.CMPR("e")
+			cycle = cpu.CMPR(regE)
 		case 0x74:
 			cpu.trace(1, "MOV M, (H)h")
-			cycle = cpu.MOVMR("h")
+			cycle = cpu.MOVMR(regH)
 		case 0x66:
 			cpu.trace(1, "MOV (H)h, M")
-			cycle = cpu.MOVRM("h")
+			cycle = cpu.MOVRM(regH)
 		case 0xBC:
 			cpu.trace(1, "CMP (H)h")
-			cycle = cpu.CMPR("h")
+			cycle = cpu.CMPR(regH)
 		case 0x75:
 			cpu.trace(1, "MOV M, (L)l")
-			cycle = cpu.MOVMR("l")
+			cycle = cpu.MOVMR(regL)
 		case 0x6E:
 			cpu.trace(1, "MOV (L)l, M")
-			cycle = cpu.MOVRM("l")
+			cycle = cpu.MOVRM(regL)
 		case 0xBD:
 			cpu.trace(1, "CMP (L)l")
-			cycle = cpu.CMPR("l")
+			cycle = cpu.CMPR(regL)
 		case 0x77:
 			cpu.trace(1, "MOV M, (A)a")
-			cycle = cpu.MOVMR("a")
+			cycle = cpu.MOVMR(regA)
 		case 0xBE:
 			cpu.trace(1, "CMP M")
 			cycle = cpu.CMPM()
@@ -1363,7 +1423,7 @@ func (cpu *cpu) executeInstruction() int {
 			cycle = cpu.ADDM()
 		case 0x7E:
 			cpu.trace(1, "MOV (A)a, M")
-			cycle = cpu.MOVRM("a")
+			cycle = cpu.MOVRM(regA)
 		case 0x96:
 			cpu.trace(1, "SUB M")
 			cycle = cpu.SUBM()
@@ -1393,13 +1453,13 @@ func (cpu *cpu) executeInstruction() int {
 			cycle = cpu.DCRM()
 		case 0x01:
 			cpu.trace(3, "LXI B, d16")
-			cycle = cpu.LXIRPD16("b", "c")
+			cycle = cpu.LXIRPD16(regB, regC)
 		case 0x11:
 			cpu.trace(3, "LXI D, d16")
-			cycle = cpu.LXIRPD16("d", "e")
+			cycle = cpu.LXIRPD16(regD, regE)
 		case 0x21:
 			cpu.trace(3, "LXI H, d16")
-			cycle = cpu.LXIRPD16("h", "l")
+			cycle = cpu.LXIRPD16(regH, regL)
 		case 0x03:
 			cpu.trace(1, "INX B")
 			cycle = cpu.INXRP("bc")
@@ -1411,7 +1471,7 @@ func (cpu *cpu) executeInstruction() int {
 			cycle = cpu.INXRP("hl")
 		case 0xB9:
 			cpu.trace(1, "CMP (C)c")
-			cycle = cpu.CMPR("c")
+			cycle = cpu.CMPR(regC)
 		case 0x0B:
 			cpu.trace(1, "DCX B")
 			cycle = cpu.DCXRP("bc")
@@ -1483,13 +1543,13 @@ func (cpu *cpu) executeInstruction() int {
 			cycle = cpu.RAR()
 		case 0xC5:
 			cpu.trace(1, "PUSH B")
-			cycle = cpu.PUSHRP("b", "c")
+			cycle = cpu.PUSHRP(regB, regC)
 		case 0xD5:
 			cpu.trace(1, "PUSH D")
-			cycle = cpu.PUSHRP("d", "e")
+			cycle = cpu.PUSHRP(regD, regE)
 		case 0xE5:
 			cpu.trace(1, "PUSH H")
-			cycle = cpu.PUSHRP("h", "l")
+			cycle = cpu.PUSHRP(regH, regL)
 		case 0xF5:
 			cpu.trace(1, "PUSH PSW")
 			cycle = cpu.PUSHPSW()
@@ -1498,13 +1558,13 @@ func (cpu *cpu) executeInstruction() int {
 			cycle = cpu.POPPSW()
 		case 0xE1:
 			cpu.trace(1, "POP H")
-			cycle = cpu.POPRP("h", "l")
+			cycle = cpu.POPRP(regH, regL)
 		case 0xD1:
 			cpu.trace(1, "POP D")
-			cycle = cpu.POPRP("d", "e")
+			cycle = cpu.POPRP(regD, regE)
 		case 0xC1:
 			cpu.trace(1, "POP B")
-			cycle = cpu.POPRP("b", "c")
+			cycle = cpu.POPRP(regB, regC)
 		case 0x39:
 			cpu.trace(1, "DAD (SP)sp")
 			cycle = cpu.DADSP()
@@ -1528,16 +1588,16 @@ func (cpu *cpu) executeInstruction() int {
 			cycle = cpu.RET()
 		case 0x76:
 			cpu.trace(1, "HLT")
-			os.Exit(4)
+			cycle = cpu.HLT()
 		case 0xA0:
 			cpu.trace(1, "ANA (B)b")
-			cycle = cpu.ANAR("b")
+			cycle = cpu.ANAR(regB)
 		case 0x71:
 			cpu.trace(1, "MOV M, (C)c")
-			cycle = cpu.MOVMR("c")
+			cycle = cpu.MOVMR(regC)
 		case 0x4E:
 			cpu.trace(1, "MOV (C)c, M")
-			cycle = cpu.MOVRM("c")
+			cycle = cpu.MOVRM(regC)
 		case 0xFB:
 			cpu.trace(1, "EI")
 			cycle = cpu.EI()
@@ -1547,11 +1607,84 @@ func (cpu *cpu) executeInstruction() int {
 		case 0xD3:
 			cpu.trace(2, "OUT")
 			cycle = cpu.OUT()
+		case 0x40:
+			cpu.trace(1, "MOV (B)b, (B)b")
+			cycle = cpu.MOVR1R2(regB, regB)
+		case 0x49:
+			cpu.trace(1, "MOV (C)c, (C)c")
+			cycle = cpu.MOVR1R2(regC, regC)
+		case 0x52:
+			cpu.trace(1, "MOV (D)d, (D)d")
+			cycle = cpu.MOVR1R2(regD, regD)
+		case 0x5B:
+			cpu.trace(1, "MOV (E)e, (E)e")
+			cycle = cpu.MOVR1R2(regE, regE)
+		case 0x64:
+			cpu.trace(1, "MOV (H)h, (H)h")
+			cycle = cpu.MOVR1R2(regH, regH)
+		case 0x6D:
+			cpu.trace(1, "MOV (L)l, (L)l")
+			cycle = cpu.MOVR1R2(regL, regL)
+		case 0x7F:
+			cpu.trace(1, "MOV (A)a, (A)a")
+			cycle = cpu.MOVR1R2(regA, regA)
+		case 0xBF:
+			cpu.trace(1, "CMP (A)a")
+			cycle = cpu.CMPR(regA)
+		case 0xF3:
+			cpu.trace(1, "DI")
+			cycle = cpu.DI()
+		//undocumented opcodes, they behave like their documented twins
+		case 0x08, 0x10, 0x18, 0x20, 0x28, 0x30, 0x38:
+			cpu.trace(1, "*NOP")
+			cycle = cpu.NOP()
+		case 0xCB:
+			cpu.trace(3, "*JMP addr")
+			cycle = cpu.JMP()
+		case 0xD9:
+			cpu.trace(1, "*RET")
+			cycle = cpu.RET()
+		case 0xDD, 0xED, 0xFD:
+			cpu.trace(3, "*CALL addr")
+			cycle = cpu.CALL()
+		case 0xC7:
+			cpu.trace(1, "RST 0")
+			cycle = cpu.RST(0)
+		case 0xCF:
+			cpu.trace(1, "RST 1")
+			cycle = cpu.RST(1)
+		case 0xD7:
+			cpu.trace(1, "RST 2")
+			cycle = cpu.RST(2)
+		case 0xDF:
+			cpu.trace(1, "RST 3")
+			cycle = cpu.RST(3)
+		case 0xE7:
+			cpu.trace(1, "RST 4")
+			cycle = cpu.RST(4)
+		case 0xEF:
+			cpu.trace(1, "RST 5")
+			cycle = cpu.RST(5)
+		case 0xF7:
+			cpu.trace(1, "RST 6")
+			cycle = cpu.RST(6)
+		case 0xFF:
+			cpu.trace(1, "RST 7")
+			cycle = cpu.RST(7)
 		default:
-			fmt.Printf("Unknown Opcode: %v, PC: %v\n", fmt.Sprintf("%X", cpu.opcode), fmt.Sprintf("%X", cpu.pc))
 			//fmt.Println(fmt.Sprintf("%X", cpu.a), cpu.carry, cpu.parity, cpu.sign, cpu.zero)
-			os.Exit(2)
+			cpu.crash(fmt.Sprintf("Unknown Opcode: %v, PC: %v", fmt.Sprintf("%X", cpu.opcode), fmt.Sprintf("%X", cpu.pc)), 2)
+	}
+
+	if cpu.profile != nil && !cpu.replaying {
+		cpu.profile.end(cpu.opcode, cycle)
+	}
+	if debugger {
+		cpu.advanceTimeline()
 	}
+	cpu.instructions++
+	cpu.cycles += uint64(cycle)
+	cpu.videoCycles += uint64(cycle)
 
 	return cycle
 }
\ No newline at end of file
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"math/bits"
+	"testing"
+)
+
+type flagCase struct {
+	name string
+	program []uint8
+	a, b uint8
+	carryIn, acIn bool
+	wantA uint8
+	zero, sign, parity, carry, ac bool
+}
+
+func TestALUFlags(t *testing.T) {
+	cases := []flagCase{
+		{"ADD carry and half carry", []uint8{0x80}, 0x3A, 0xC6, false, false, 0x00, true, false, true, true, true},
+		{"ADC adds carry", []uint8{0x88}, 0x0F, 0x00, true, false, 0x10, false, false, false, false, true},
+		{"SUB A sets AC", []uint8{0x97}, 0x3E, 0x00, false, false, 0x00, true, false, true, false, true},
+		{"SUB borrow", []uint8{0x90}, 0x01, 0x02, false, false, 0xFF, false, true, true, true, false},
+		{"SBB with borrow in", []uint8{0x98}, 0x05, 0x02, true, false, 0x02, false, false, false, false, true},
+		{"CMP equal leaves A", []uint8{0xB8}, 0x42, 0x42, false, false, 0x42, true, false, true, false, true},
+		{"ANA AC from bit 3", []uint8{0xA0}, 0x08, 0x00, true, false, 0x00, true, false, true, false, true},
+		{"XRA clears CY and AC", []uint8{0xA8}, 0xFF, 0x0F, true, true, 0xF0, false, true, true, false, false},
+		{"ORA clears CY and AC", []uint8{0xB0}, 0x01, 0x02, true, true, 0x03, false, false, true, false, false},
+		{"INR keeps CY", []uint8{0x3C}, 0x0F, 0x00, true, false, 0x10, false, false, false, true, true},
+		{"DCR half borrow", []uint8{0x3D}, 0x10, 0x00, false, false, 0x0F, false, false, true, false, false},
+		{"DCR no half borrow", []uint8{0x3D}, 0x01, 0x00, false, false, 0x00, true, false, true, false, true},
+		{"DAA manual example", []uint8{0x27}, 0x9B, 0x00, false, false, 0x01, false, false, false, true, true},
+		{"DAA keeps carry", []uint8{0x27}, 0x00, 0x00, true, false, 0x60, false, false, true, true, false},
+	}
+
+	for _, c := range cases {
+		cpu := cpu{}
+		cpu.cpuInit()
+		copy(cpu.memory[:], c.program)
+		cpu.regs[regA], cpu.regs[regB] = c.a, c.b
+		cpu.carry, cpu.ac = c.carryIn, c.acIn
+
+		cpu.executeInstruction()
+
+		if cpu.regs[regA] != c.wantA {
+			t.Errorf("%v: A = %02X, want %02X", c.name, cpu.regs[regA], c.wantA)
+		}
+		if cpu.zero != c.zero || cpu.sign != c.sign || cpu.parity != c.parity || cpu.carry != c.carry || cpu.ac != c.ac {
+			t.Errorf("%v: Z:%v S:%v P:%v CY:%v AC:%v, want Z:%v S:%v P:%v CY:%v AC:%v", c.name,
+				cpu.zero, cpu.sign, cpu.parity, cpu.carry, cpu.ac, c.zero, c.sign, c.parity, c.carry, c.ac)
+		}
+	}
+}
+
+func TestDADCarry(t *testing.T) {
+	cpu := cpu{}
+	cpu.cpuInit()
+	cpu.memory[0] = 0x09 //DAD B
+	cpu.load16BitReg("hl", 0xFFFF)
+	cpu.load16BitReg("bc", 0x0002)
+
+	cpu.executeInstruction()
+
+	if hl := cpu.get16BitReg("hl"); hl != 0x0001 || !cpu.carry {
+		t.Fatalf("DAD B: HL = %04X CY:%v, want 0001 CY:true", hl, cpu.carry)
+	}
+}
+
+//opcodes the fuzzer does not run: IN polls the keyboard
+var fuzzSkip = map[uint8]bool{0xDB: true}
+
+func isBranch(op uint8) bool {
+	switch {
+	case op & 0xC7 == 0xC0, op & 0xC7 == 0xC2, op & 0xC7 == 0xC4, op & 0xC7 == 0xC7: //Rcc, Jcc, Ccc, RST
+		return true
+	}
+	switch op {
+	case 0xC3, 0xCB, 0xC9, 0xD9, 0xCD, 0xDD, 0xED, 0xFD, 0xE9: //JMP, RET, CALL and their twins, PCHL
+		return true
+	}
+	return false
+}
+
+//the value an ALU opcode works on, ok is false for opcodes that are not ALU operations on A
+func aluOperand(cpu *cpu, op uint8) (uint8, bool) {
+	if op >= 0x80 && op <= 0xBF {
+		switch op & 0x07 {
+		case 0:
+			return cpu.regs[regB], true
+		case 1:
+			return cpu.regs[regC], true
+		case 2:
+			return cpu.regs[regD], true
+		case 3:
+			return cpu.regs[regE], true
+		case 4:
+			return cpu.regs[regH], true
+		case 5:
+			return cpu.regs[regL], true
+		case 6:
+			return cpu.memory[cpu.get16BitReg("hl")], true
+		default:
+			return cpu.regs[regA], true
+		}
+	}
+	if op & 0xC7 == 0xC6 {
+		return cpu.memory[cpu.pc + 1], true
+	}
+	return 0, false
+}
+
+func FuzzExecuteInstruction(f *testing.F) {
+	f.Add([]byte{0xC5}, uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint16(0), uint16(0)) //PUSH B with SP 0
+	f.Add([]byte{0xC9}, uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint16(0xFFFF), uint16(0xFFFF)) //RET at the top of memory
+	f.Add([]byte{0x86, 0x01}, uint8(0x3A), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0xFF), uint8(0xFF), uint8(0xD7), uint16(0x2400), uint16(0xFFFE)) //ADD M
+	f.Add([]byte{0x27}, uint8(0x9B), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0x13), uint16(0x2400), uint16(0x100)) //DAA
+	f.Add([]byte{0xFE, 0x80}, uint8(0x7F), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), uint8(0x02), uint16(0x2400), uint16(0x100)) //CPI
+
+	f.Fuzz(func(t *testing.T, image []byte, a, b, c, d, e, h, l, flags uint8, sp uint16, pc uint16) {
+		if len(image) == 0 {
+			return
+		}
+		cpu := cpu{}
+		cpu.cpuInit()
+		for i := range cpu.memory {
+			cpu.memory[pc + uint16(i)] = image[i % len(image)]
+		}
+		cpu.regs = [7]uint8{a, b, c, d, e, h, l}
+		cpu.setFlagsByte(flags)
+		cpu.sp, cpu.pc = sp, pc
+
+		op := cpu.memory[pc]
+		if fuzzSkip[op] {
+			return
+		}
+		operand, isALU := aluOperand(&cpu, op)
+		isCompare := op >= 0xB8 && op <= 0xBF || op == 0xFE
+		carryIn := cpu.carryValue()
+
+		cpu.executeInstruction()
+
+		if !isBranch(op) {
+			if want := pc + uint16(opcodeTable[op].length); cpu.pc != want {
+				t.Fatalf("opcode %02X at %04X: PC = %04X, want %04X", op, pc, cpu.pc, want)
+			}
+		}
+
+		if isALU {
+			result := cpu.regs[regA]
+			if isCompare {
+				result = a - operand
+			}
+			if cpu.zero != (result == 0) || cpu.sign != (result & 0x80 != 0) || cpu.parity != (bits.OnesCount8(result) % 2 == 0) {
+				t.Fatalf("opcode %02X: result %02X with Z:%v S:%v P:%v", op, result, cpu.zero, cpu.sign, cpu.parity)
+			}
+			switch op & 0x38 {
+			case 0x00, 0x08: //ADD, ADC
+				carry := op & 0x08 != 0 && carryIn == 1
+				if want := uint16(a) + uint16(operand) + uint16(flagBit(carry)) > 0xFF; cpu.carry != want {
+					t.Fatalf("opcode %02X: %02X + %02X CY:%v, want %v", op, a, operand, cpu.carry, want)
+				}
+			case 0x10, 0x18, 0x38: //SUB, SBB, CMP
+				borrow := op & 0x38 == 0x18 && carryIn == 1
+				if want := uint16(a) < uint16(operand) + uint16(flagBit(borrow)); cpu.carry != want {
+					t.Fatalf("opcode %02X: %02X - %02X CY:%v, want %v", op, a, operand, cpu.carry, want)
+				}
+			default: //ANA, XRA, ORA
+				if cpu.carry {
+					t.Fatalf("opcode %02X: logical operation left CY set", op)
+				}
+			}
+		}
+	})
+}
+
+func FuzzPushPopPSW(f *testing.F) {
+	f.Add(uint8(0x00), uint8(0x00), uint16(0x0000))
+	f.Add(uint8(0xFF), uint8(0xFF), uint16(0x0001))
+	f.Add(uint8(0x42), uint8(0xD5), uint16(0x2400))
+
+	f.Fuzz(func(t *testing.T, a uint8, flags uint8, sp uint16) {
+		cpu := cpu{}
+		cpu.cpuInit()
+		//keep the program well away from the stack
+		cpu.pc = sp + 0x8000
+		cpu.memory[cpu.pc] = 0xF5 //PUSH PSW
+		cpu.memory[cpu.pc + 1] = 0xF1 //POP PSW
+		cpu.regs[regA] = a
+		cpu.setFlagsByte(flags)
+		cpu.sp = sp
+		pushed := cpu.flagsByte()
+
+		cpu.executeInstruction()
+		stored := cpu.memory[cpu.sp]
+		if stored & 0x02 == 0 || stored & 0x28 != 0 {
+			t.Fatalf("PUSH PSW stored flag byte %08b, bit 1 must be set and bits 3 and 5 clear", stored)
+		}
+		if stored != pushed || cpu.memory[cpu.sp + 1] != a {
+			t.Fatalf("PUSH PSW stored %02X %02X, want %02X %02X", cpu.memory[cpu.sp + 1], stored, a, pushed)
+		}
+
+		cpu.regs[regA] = ^a
+		cpu.setFlagsByte(^flags)
+		cpu.executeInstruction()
+		if cpu.regs[regA] != a || cpu.flagsByte() != pushed || cpu.sp != sp {
+			t.Fatalf("POP PSW gave A:%02X F:%08b SP:%04X, want A:%02X F:%08b SP:%04X", cpu.regs[regA], cpu.flagsByte(), cpu.sp, a, pushed, sp)
+		}
+	})
+}
+
+//a loop mixing register, memory and 16-bit instructions, like the inner loops of a game
+var benchmarkLoop = []string{
+	"        LXI SP, 4000H",
+	"        LXI H, 2400H",
+	"start:  MVI D, 0",
+	"loop:   MOV A, M",
+	"        ADD D",
+	"        XRA B",
+	"        MOV M, A",
+	"        INX H",
+	"        PUSH H",
+	"        POP H",
+	"        DCR D",
+	"        JNZ loop",
+	"        CALL sub",
+	"        JMP start",
+	"sub:    RET",
+}
+
+func BenchmarkExecuteInstruction(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		source []string
+	}{
+		{"nop", []string{"loop: NOP", "NOP", "NOP", "JMP loop"}},
+		{"loop", benchmarkLoop},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			asm, err := assemble(bench.source, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			cpu := freshCpu(nil, nil)
+			copy(cpu.memory[:], asm.code)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cpu.executeInstruction()
+			}
+			b.ReportMetric(float64(b.N) / b.Elapsed().Seconds() / 1000000, "Minstr/s")
+			b.ReportMetric(float64(cpu.cycles) / b.Elapsed().Seconds() / 1000000, "MHz")
+		})
+	}
+}
+
+//the cost of a trace call with -d off, it should inline to a bool check
+func BenchmarkTraceDisabled(b *testing.B) {
+	cpu := freshCpu(nil, nil)
+	for i := 0; i < b.N; i++ {
+		cpu.trace(3, "LXI (SP)sp, d16")
+	}
+}
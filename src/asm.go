@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//a small two pass 8080 assembler for scenario programs: the mnemonics in opcodeTable, labels,
+//ORG, EQU, DB, DW, DS, and expressions made of numbers, labels, characters, $ and + -
+
+type asmTemplate struct {
+	operands []string //register names, or d8/d16/addr for an expression
+	opcode uint8
+}
+
+var asmTemplates = map[string][]asmTemplate{}
+
+func init() {
+	for op, info := range opcodeTable {
+		if strings.HasPrefix(info.mnemonic, "*") {
+			continue
+		}
+		mnemonic, operands, _ := strings.Cut(info.mnemonic, " ")
+		template := asmTemplate{opcode: uint8(op)}
+		if operands != "" {
+			template.operands = strings.Split(operands, ",")
+		}
+		asmTemplates[mnemonic] = append(asmTemplates[mnemonic], template)
+	}
+}
+
+type asmStatement struct {
+	line int
+	label string
+	op string
+	operands []string
+}
+
+type assembly struct {
+	origin uint16 //address of code[0]
+	code []uint8
+	symbols map[string]uint16
+}
+
+func assemble(source []string, origin uint16) (*assembly, error) {
+	statements := []asmStatement{}
+	for n, line := range source {
+		statement, err := parseAsmLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", n + 1, err)
+		}
+		statement.line = n + 1
+		statements = append(statements, statement)
+	}
+
+	asm := &assembly{origin: origin, symbols: map[string]uint16{}}
+	//pass 1 places the labels, pass 2 emits the bytes
+	for pass := 1; pass <= 2; pass++ {
+		asm.code = asm.code[:0]
+		asm.origin = origin
+		pc := origin
+		for _, statement := range statements {
+			if pass == 1 && statement.label != "" && statement.op != "EQU" {
+				if _, defined := asm.symbols[statement.label]; defined {
+					return nil, fmt.Errorf("line %v: %v defined twice", statement.line, statement.label)
+				}
+				asm.symbols[statement.label] = pc
+			}
+			bytes, err := asm.encode(statement, pc, pass == 2)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", statement.line, err)
+			}
+			if statement.op == "ORG" {
+				next, _ := asm.eval(statement.operands[0], pc, true)
+				if len(asm.code) == 0 {
+					asm.origin = next
+				} else if next < pc {
+					return nil, fmt.Errorf("line %v: ORG %04X goes backwards", statement.line, next)
+				} else {
+					asm.code = append(asm.code, make([]uint8, next - pc)...)
+				}
+				pc = next
+				continue
+			}
+			asm.code = append(asm.code, bytes...)
+			pc += uint16(len(bytes))
+		}
+	}
+	return asm, nil
+}
+
+//the first word of s and the rest, split at spaces or tabs
+func asmSplitWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i + 1:])
+}
+
+func asmKnownOp(op string) bool {
+	switch op {
+	case "ORG", "EQU", "DB", "DW", "DS":
+		return true
+	}
+	_, ok := asmTemplates[op]
+	return ok
+}
+
+//"label: OP a, b ; comment"
+func parseAsmLine(line string) (asmStatement, error) {
+	statement := asmStatement{}
+	if i := asmIndexOutsideQuotes(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	firstColumn := line != "" && line[0] != ' ' && line[0] != '\t'
+	line = strings.TrimSpace(line)
+	if i := asmIndexOutsideQuotes(line, ':'); i >= 0 {
+		statement.label = strings.ToUpper(strings.TrimSpace(line[:i]))
+		line = strings.TrimSpace(line[i + 1:])
+	}
+	if line == "" {
+		return statement, nil
+	}
+
+	op, operands := asmSplitWord(line)
+	statement.op = strings.ToUpper(op)
+	//"NAME EQU value" anywhere, and "name OP ..." in the first column, without a colon
+	if next, rest := asmSplitWord(operands); statement.label == "" && (strings.ToUpper(next) == "EQU" || firstColumn && !asmKnownOp(statement.op)) {
+		statement.label = statement.op
+		statement.op = strings.ToUpper(next)
+		operands = rest
+		if statement.op == "" {
+			return statement, nil
+		}
+	}
+	for operands != "" {
+		i := asmIndexOutsideQuotes(operands, ',')
+		if i < 0 {
+			i = len(operands)
+		}
+		statement.operands = append(statement.operands, strings.TrimSpace(operands[:i]))
+		operands = operands[min(i + 1, len(operands)):]
+	}
+	if statement.op == "EQU" && statement.label == "" {
+		return statement, fmt.Errorf("EQU without a name")
+	}
+	return statement, nil
+}
+
+func asmIndexOutsideQuotes(text string, ch byte) int {
+	quoted := false
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\'' {
+			quoted = !quoted
+		} else if text[i] == ch && !quoted {
+			return i
+		}
+	}
+	return -1
+}
+
+//bytes for one statement at pc, undefined labels are only an error when final is set
+func (asm *assembly) encode(statement asmStatement, pc uint16, final bool) ([]uint8, error) {
+	bytes := []uint8{}
+	switch statement.op {
+	case "":
+		return bytes, nil
+	case "ORG":
+		if len(statement.operands) != 1 {
+			return nil, fmt.Errorf("ORG takes one address")
+		}
+		_, err := asm.eval(statement.operands[0], pc, true)
+		return bytes, err
+	case "EQU":
+		if len(statement.operands) != 1 {
+			return nil, fmt.Errorf("EQU takes one value")
+		}
+		value, err := asm.eval(statement.operands[0], pc, final)
+		asm.symbols[statement.label] = value
+		return bytes, err
+	case "DB":
+		for _, operand := range statement.operands {
+			if len(operand) >= 2 && operand[0] == '\'' && operand[len(operand) - 1] == '\'' && len(operand) != 3 {
+				bytes = append(bytes, operand[1:len(operand) - 1]...)
+				continue
+			}
+			value, err := asm.eval(operand, pc, final)
+			if err != nil {
+				return nil, err
+			}
+			bytes = append(bytes, uint8(value))
+		}
+		return bytes, nil
+	case "DW":
+		for _, operand := range statement.operands {
+			value, err := asm.eval(operand, pc, final)
+			if err != nil {
+				return nil, err
+			}
+			bytes = append(bytes, uint8(value), uint8(value >> 8))
+		}
+		return bytes, nil
+	case "DS":
+		if len(statement.operands) != 1 {
+			return nil, fmt.Errorf("DS takes one size")
+		}
+		size, err := asm.eval(statement.operands[0], pc, true)
+		return make([]uint8, size), err
+	}
+
+	templates, ok := asmTemplates[statement.op]
+	if !ok {
+		return nil, fmt.Errorf("unknown instruction %v", statement.op)
+	}
+	for _, template := range templates {
+		if len(template.operands) != len(statement.operands) {
+			continue
+		}
+		matched := true
+		expression := ""
+		for i, operand := range template.operands {
+			switch operand {
+			case "d8", "d16", "addr":
+				expression = statement.operands[i]
+			default:
+				matched = matched && strings.EqualFold(operand, statement.operands[i])
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		bytes = append(bytes, template.opcode)
+		if expression != "" {
+			value, err := asm.eval(expression, pc, final)
+			if err != nil {
+				return nil, err
+			}
+			bytes = append(bytes, uint8(value))
+			if opcodeTable[template.opcode].length == 3 {
+				bytes = append(bytes, uint8(value >> 8))
+			}
+		}
+		return bytes, nil
+	}
+	return nil, fmt.Errorf("bad operands for %v: %v", statement.op, strings.Join(statement.operands, ","))
+}
+
+//terms joined with + and -, a term is a number (12, 0x0C, 0CH, $0C), 'c', a label, or $ for the current address
+func (asm *assembly) eval(expression string, pc uint16, final bool) (uint16, error) {
+	var total uint16
+	sign := uint16(1)
+	term := ""
+	flush := func() error {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return fmt.Errorf("bad expression %q", expression)
+		}
+		value, err := asm.term(term, pc, final)
+		total += sign * value
+		term = ""
+		return err
+	}
+
+	quoted := false
+	for i := 0; i < len(expression); i++ {
+		ch := expression[i]
+		if ch == '\'' {
+			quoted = !quoted
+		}
+		if !quoted && (ch == '+' || ch == '-') && strings.TrimSpace(term) != "" {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+			sign = 1
+			if ch == '-' {
+				sign = 0xFFFF
+			}
+			continue
+		}
+		term += string(ch)
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+func (asm *assembly) term(term string, pc uint16, final bool) (uint16, error) {
+	upper := strings.ToUpper(term)
+	switch {
+	case term == "$":
+		return pc, nil
+	case len(term) == 3 && term[0] == '\'' && term[2] == '\'':
+		return uint16(term[1]), nil
+	case strings.HasPrefix(term, "-"):
+		value, err := asm.term(term[1:], pc, final)
+		return -value, err
+	}
+
+	text, base := upper, 0
+	if strings.HasPrefix(text, "$") {
+		text, base = text[1:], 16
+	} else if strings.HasSuffix(text, "H") && text[0] >= '0' && text[0] <= '9' {
+		text, base = text[:len(text) - 1], 16
+	} else if strings.HasSuffix(text, "B") && strings.Trim(text[:len(text) - 1], "01") == "" && len(text) > 1 {
+		text, base = text[:len(text) - 1], 2
+	}
+	if value, err := strconv.ParseUint(text, base, 16); err == nil {
+		return uint16(value), nil
+	}
+	if term[0] >= '0' && term[0] <= '9' {
+		return 0, fmt.Errorf("bad number %v", term)
+	}
+
+	value, defined := asm.symbols[upper]
+	if !defined && final {
+		return 0, fmt.Errorf("undefined label %v", term)
+	}
+	return value, nil
+}
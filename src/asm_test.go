@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	source := []string{
+		"COUNT EQU 3",
+		"        ORG 0100H",
+		"start:  LXI SP, 2400H   ; stack",
+		"        MVI B, COUNT",
+		"loop:   DCR B",
+		"        JNZ loop",
+		"        MOV M, A",
+		"        RST 1",
+		"        CPI 'a'",
+		"        JMP $ + 3 - 3",
+		"msg:    DB 'HI', 0DH, 0AH, '$'",
+		"        DW msg, -1",
+		"\tMOV\tA,\tB",
+		"next\tDCR B",
+		"\tJMP\tnext",
+		"LIMIT\tEQU\t0FFH",
+		"\tCPI LIMIT",
+	}
+	want := []uint8{
+		0x31, 0x00, 0x24,
+		0x06, 0x03,
+		0x05,
+		0xC2, 0x05, 0x01,
+		0x77,
+		0xCF,
+		0xFE, 'a',
+		0xC3, 0x0D, 0x01,
+		'H', 'I', 0x0D, 0x0A, '$',
+		0x10, 0x01, 0xFF, 0xFF,
+		0x78,
+		0x05,
+		0xC3, 0x1A, 0x01,
+		0xFE, 0xFF,
+	}
+
+	asm, err := assemble(source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asm.origin != 0x0100 {
+		t.Fatalf("origin %04X, want 0100", asm.origin)
+	}
+	if !bytes.Equal(asm.code, want) {
+		t.Fatalf("assembled\n% X\nwant\n% X", asm.code, want)
+	}
+	if asm.symbols["LOOP"] != 0x0105 || asm.symbols["COUNT"] != 3 || asm.symbols["NEXT"] != 0x011A {
+		t.Fatalf("symbols %v", asm.symbols)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	for _, line := range []string{"FOO A", "MOV A, X, Y", "JMP nowhere", "MVI A, 12Q"} {
+		if _, err := assemble([]string{line}, 0); err == nil {
+			t.Errorf("%q assembled without an error", line)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"github.com/gen2brain/raylib-go/raylib"
+	"image/color"
+	"os"
+)
+
+//in the cabinet the monitor's picture is reflected off a half-silvered mirror in front of a painted
+//moonscape, so lit pixels add their light to the backdrop and black pixels let it show through
+
+var bezelColor = color.RGBA{24, 24, 24, 255}
+var bezelEdgeColor = color.RGBA{70, 70, 70, 255}
+
+type backdrop struct {
+	texture rl.Texture2D
+	source rl.Rectangle //the part of the image behind the screen, cropped to its aspect
+}
+
+func loadBackdrop(imagePath string) (*backdrop, error) {
+	if _, err := os.Stat(imagePath); err != nil {
+		return nil, err
+	}
+	texture := rl.LoadTexture(imagePath)
+	if texture.Width == 0 || texture.Height == 0 {
+		return nil, fmt.Errorf("%v: not an image raylib can load", imagePath)
+	}
+	return &backdrop{texture, backdropSource(float32(texture.Width), float32(texture.Height))}, nil
+}
+
+func (backdrop *backdrop) unload() {
+	rl.UnloadTexture(backdrop.texture)
+}
+
+//the largest centred part of a width x height image with the screen's 224:256 aspect, so the
+//backdrop covers the whole picture without being stretched
+func backdropSource(width float32, height float32) rl.Rectangle {
+	aspect := float32(frameWidth) / float32(frameHeight)
+	if width / height > aspect {
+		cropped := height * aspect
+		return rl.NewRectangle((width - cropped) / 2, 0, cropped, height)
+	}
+	cropped := width / aspect
+	return rl.NewRectangle(0, (height - cropped) / 2, width, cropped)
+}
+
+//where the picture goes in the window, inside a bezel of bezel pixels (before scaling) on every side
+func screenRect() rl.Rectangle {
+	return rl.NewRectangle(float32(bezel) * scale, float32(bezel) * scale, frameWidth * scale, frameHeight * scale)
+}
+
+func windowSize() (int32, int32) {
+	return int32(float32(frameWidth + bezel * 2) * scale), int32(float32(frameHeight + bezel * 2) * scale)
+}
+
+//draws the bezel, the backdrop if there is one and the picture on top of it
+func drawScreen(screenTexture rl.Texture2D, backdrop *backdrop) {
+	dest := screenRect()
+	if bezel > 0 {
+		rl.ClearBackground(bezelColor)
+		edge := 2 * scale
+		rl.DrawRectangleLinesEx(rl.NewRectangle(dest.X - edge, dest.Y - edge, dest.Width + edge * 2, dest.Height + edge * 2), edge, bezelEdgeColor)
+	}
+
+	source := rl.NewRectangle(0, 0, frameWidth, frameHeight)
+	if backdrop == nil {
+		rl.DrawTexturePro(screenTexture, source, dest, rl.NewVector2(0, 0), 0, rl.White)
+		return
+	}
+	rl.DrawTexturePro(backdrop.texture, backdrop.source, dest, rl.NewVector2(0, 0), 0, rl.White)
+	rl.BeginBlendMode(rl.BlendAdditive)
+	rl.DrawTexturePro(screenTexture, source, dest, rl.NewVector2(0, 0), 0, rl.White)
+	rl.EndBlendMode()
+}
@@ -0,0 +1,35 @@
+//go:build !headless
+
+package main
+
+import (
+	"github.com/gen2brain/raylib-go/raylib"
+	"testing"
+)
+
+func TestBackdropSource(t *testing.T) {
+	for _, test := range []struct {
+		width, height float32
+		want rl.Rectangle
+	}{
+		{224, 256, rl.NewRectangle(0, 0, 224, 256)},
+		{800, 256, rl.NewRectangle(288, 0, 224, 256)}, //wide, the sides are cropped
+		{448, 1024, rl.NewRectangle(0, 256, 448, 512)}, //tall, the top and bottom are cropped
+	} {
+		if got := backdropSource(test.width, test.height); got != test.want {
+			t.Errorf("%vx%v: source %v, want %v", test.width, test.height, got, test.want)
+		}
+	}
+}
+
+func TestBezel(t *testing.T) {
+	defer func(oldScale float32, oldBezel int) { scale, bezel = oldScale, oldBezel }(scale, bezel)
+	scale, bezel = 2, 16
+
+	if width, height := windowSize(); width != 512 || height != 576 {
+		t.Fatalf("window %vx%v, want 512x576", width, height)
+	}
+	if rect := screenRect(); rect != rl.NewRectangle(32, 32, 448, 512) {
+		t.Fatalf("screen at %v, want 32,32 448x512", rect)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+const callStackMax = 256
+
+//one entry of the shadow call stack, pushed by CALL/RST/interrupts and popped by RET
+type callFrame struct {
+	kind string //CALL, RST n, INT n
+	from uint16 //pc of the call instruction (or where the interrupt hit)
+	target uint16 //address jumped to
+	returnAddr uint16 //address pushed on the real stack
+	sp uint16 //sp after the return address was pushed
+	startCycles uint64 //profiler cycle count when the frame was pushed
+}
+
+func (cpu *cpu) pushCallFrame(kind string, target uint16, returnAddr uint16) {
+	if len(cpu.callStack) >= callStackMax {
+		//drop the oldest frame, code that never returns should not grow this forever
+		cpu.callStack = cpu.callStack[1:]
+	}
+	var startCycles uint64
+	if cpu.profile != nil {
+		startCycles = cpu.profile.totalCycles
+	}
+	cpu.callStack = append(cpu.callStack, callFrame{kind, cpu.pc, target, returnAddr, cpu.sp, startCycles})
+}
+
+//called after a RET has been taken, retPC is the pc of the RET, sp is the sp before the return address was popped
+func (cpu *cpu) popCallFrame(retPC uint16, sp uint16) {
+	if len(cpu.callStack) == 0 {
+		cpu.callStackWarning(fmt.Sprintf("RET at %04X to %04X without a matching call", retPC, cpu.pc))
+		return
+	}
+
+	top := len(cpu.callStack) - 1
+	for i := top; i >= 0; i-- {
+		if cpu.callStack[i].sp != sp {
+			continue
+		}
+		if i != top {
+			cpu.callStackWarning(fmt.Sprintf("RET at %04X unwound %v frame(s) left on the stack", retPC, top - i))
+		}
+		if cpu.callStack[i].returnAddr != cpu.pc {
+			cpu.callStackWarning(fmt.Sprintf("RET at %04X returned to %04X, expected %04X (%v from %04X)",
+				retPC, cpu.pc, cpu.callStack[i].returnAddr, cpu.callStack[i].kind, cpu.callStack[i].from))
+		}
+		if cpu.profile != nil && !cpu.replaying {
+			for j := top; j >= i; j-- {
+				cpu.profile.leave(cpu.callStack[j])
+			}
+		}
+		cpu.callStack = cpu.callStack[:i]
+		return
+	}
+
+	cpu.callStackWarning(fmt.Sprintf("RET at %04X with SP:%04X does not match any frame, top frame SP:%04X (stack pointer corrupted?)",
+		retPC, sp, cpu.callStack[top].sp))
+}
+
+//XTHL swapped the word on top of the stack, when that is a frame's return address the frame now
+//returns to the new word (code uses this to return somewhere else or to pass on an address)
+func (cpu *cpu) swapCallFrameReturn() {
+	top := len(cpu.callStack) - 1
+	if top < 0 || cpu.callStack[top].sp != cpu.sp {
+		return
+	}
+	returnAddr := uint16(cpu.memory[cpu.sp]) | uint16(cpu.memory[cpu.sp + 1]) << 8
+	cpu.callStackWarning(fmt.Sprintf("XTHL at %04X changed the return address of the %v from %04X from %04X to %04X",
+		cpu.pc, cpu.callStack[top].kind, cpu.callStack[top].from, cpu.callStack[top].returnAddr, returnAddr))
+	cpu.callStack[top].returnAddr = returnAddr
+}
+
+//drops frames whose return address is above the new sp, used when LXI SP or SPHL move the stack
+func (cpu *cpu) trimCallStack() {
+	for len(cpu.callStack) > 0 && cpu.callStack[len(cpu.callStack) - 1].sp < cpu.sp {
+		frame := cpu.callStack[len(cpu.callStack) - 1]
+		cpu.callStackWarning(fmt.Sprintf("SP moved to %04X at %04X, discarding %v frame from %04X", cpu.sp, cpu.pc, frame.kind, frame.from))
+		cpu.callStack = cpu.callStack[:len(cpu.callStack) - 1]
+	}
+}
+
+func (cpu *cpu) callStackWarning(msg string) {
+	if (debug || debugger) && !cpu.replaying {
+		fmt.Println("Call stack:", msg)
+	}
+}
+
+func (cpu *cpu) printBacktrace(w io.Writer) {
+	fmt.Fprintf(w, "Backtrace (most recent first), PC:%04X SP:%04X\n", cpu.pc, cpu.sp)
+	if len(cpu.callStack) == 0 {
+		fmt.Fprintln(w, "  <empty>")
+		return
+	}
+	for i := len(cpu.callStack) - 1; i >= 0; i-- {
+		frame := cpu.callStack[i]
+		fmt.Fprintf(w, "  #%-3v %-6v %04X from %04X, returns to %04X, SP:%04X\n",
+			len(cpu.callStack) - 1 - i, frame.kind, frame.target, frame.from, frame.returnAddr, frame.sp)
+	}
+}
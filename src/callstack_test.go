@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+//a subroutine that swaps its return address with XTHL returns there without a mismatch
+func TestXTHLReturnAddress(t *testing.T) {
+	cpu := freshCpu(nil, nil)
+	asm, err := assemble([]string{
+		"        LXI SP, 2400H",
+		"        CALL sub",
+		"        HLT",
+		"target: HLT",
+		"sub:    LXI H, target",
+		"        XTHL",
+		"        RET",
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(cpu.memory[:], asm.code)
+
+	for cpu.pc != asm.symbols["SUB"] + 3 {
+		cpu.executeInstruction()
+	}
+	cpu.executeInstruction() //XTHL
+	if len(cpu.callStack) != 1 || cpu.callStack[0].returnAddr != asm.symbols["TARGET"] {
+		t.Fatalf("after XTHL the call stack is %+v, want one frame returning to %04X", cpu.callStack, asm.symbols["TARGET"])
+	}
+	if cpu.get16BitReg("hl") != 6 {
+		t.Fatalf("HL = %04X, want the old return address 0006", cpu.get16BitReg("hl"))
+	}
+
+	cpu.executeInstruction() //RET
+	if cpu.pc != asm.symbols["TARGET"] || len(cpu.callStack) != 0 {
+		t.Fatalf("RET went to %04X leaving %v frames", cpu.pc, len(cpu.callStack))
+	}
+}
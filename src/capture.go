@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+//pictures of the screen in pure Go: PNG frames and screenshots, and animated GIFs of a span of
+//frames, all made from the framebuffer with the overlay already applied
+
+//GIF delays are in 1/100s and most viewers slow anything under 2 down, so the GIF gets every
+//second frame at 30 frames a second
+const gifFrameStep = 2
+
+//the 224x256 framebuffer as an image
+func frameImage(pixelData []color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, frameWidth, frameHeight))
+	for i, pixel := range pixelData {
+		img.SetRGBA(i % frameWidth, i / frameWidth, pixel)
+	}
+	return img
+}
+
+//every pixel as a factor x factor block, sharp instead of smoothed
+func scaleImage(img *image.RGBA, factor int) *image.RGBA {
+	if factor <= 1 {
+		return img
+	}
+	bounds := img.Bounds()
+	scaled := image.NewRGBA(image.Rect(0, 0, bounds.Dx() * factor, bounds.Dy() * factor))
+	for y := 0; y < scaled.Rect.Dy(); y++ {
+		for x := 0; x < scaled.Rect.Dx(); x++ {
+			scaled.SetRGBA(x, y, img.RGBAAt(bounds.Min.X + x / factor, bounds.Min.Y + y / factor))
+		}
+	}
+	return scaled
+}
+
+func writePNG(filePath string, img image.Image) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+//whether -png or -pngevery asked for this frame, frames count from 1
+func pngWanted(frame int) bool {
+	if pngEvery > 0 && frame % pngEvery == 0 {
+		return true
+	}
+	for _, wanted := range pngFrames {
+		if frame == wanted {
+			return true
+		}
+	}
+	return false
+}
+
+//the frames of a GIF being recorded, the picture only has a handful of colours so each frame gets
+//an exact palette
+type gifRecorder struct {
+	anim gif.GIF
+	elapsed int //frames added, for the delays
+}
+
+func (recorder *gifRecorder) add(img *image.RGBA) {
+	palette := color.Palette{}
+	seen := map[color.RGBA]bool{}
+	for i := 0; i < len(img.Pix) && len(palette) < 256; i += 4 {
+		pixel := color.RGBA{img.Pix[i], img.Pix[i + 1], img.Pix[i + 2], img.Pix[i + 3]}
+		if !seen[pixel] {
+			seen[pixel] = true
+			palette = append(palette, pixel)
+		}
+	}
+	paletted := image.NewPaletted(img.Bounds(), palette)
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			paletted.Set(x, y, img.RGBAAt(x, y))
+		}
+	}
+
+	//delays rounded so they add up to the real time, 3 3 4 3 3 4... at 30 frames a second
+	start := recorder.elapsed * gifFrameStep * 100 / frameRate
+	recorder.elapsed++
+	end := recorder.elapsed * gifFrameStep * 100 / frameRate
+	recorder.anim.Image = append(recorder.anim.Image, paletted)
+	recorder.anim.Delay = append(recorder.anim.Delay, end - start)
+}
+
+func (recorder *gifRecorder) write(filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(file, &recorder.anim); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+//everything that wants a copy of the picture: -png frames, the -gif span and the screenshot and
+//GIF hotkeys in the window
+type capture struct {
+	pngs int //-png/-pngevery frames written
+	gif *gifRecorder //nil unless a GIF is being recorded
+	gifPath string
+	gifFirst, gifLast int //frames the recording started and stops at, gifLast is 0 to keep going until it is stopped
+}
+
+//called after every frame with the frame number, counting from 1
+func (capture *capture) frame(frame int, pixelData []color.RGBA) error {
+	if pngWanted(frame) {
+		if err := os.MkdirAll(pngDir, 0755); err != nil {
+			return err
+		}
+		framePath := filepath.Join(pngDir, fmt.Sprintf("frame_%06d.png", frame))
+		if err := writePNG(framePath, scaleImage(frameImage(pixelData), captureScale)); err != nil {
+			return err
+		}
+		capture.pngs++
+	}
+
+	if capture.gif == nil && gifPath != "" && frame == gifFirst {
+		capture.startGif(gifPath, frame, gifLast)
+	}
+	if capture.gif != nil {
+		if (frame - capture.gifFirst) % gifFrameStep == 0 {
+			capture.gif.add(scaleImage(frameImage(pixelData), captureScale))
+		}
+		if frame == capture.gifLast {
+			return capture.stopGif()
+		}
+	}
+	return nil
+}
+
+func (capture *capture) startGif(filePath string, first int, last int) {
+	capture.gif = &gifRecorder{}
+	capture.gifPath = filePath
+	capture.gifFirst, capture.gifLast = first, last
+	fmt.Println("Recording GIF:", filePath)
+}
+
+func (capture *capture) stopGif() error {
+	recorder := capture.gif
+	capture.gif = nil
+	if err := recorder.write(capture.gifPath); err != nil {
+		return err
+	}
+	fmt.Printf("GIF of %v frames written to: %v\n", len(recorder.anim.Image), capture.gifPath)
+	return nil
+}
+
+//the screenshot hotkey, a PNG of the current frame in pngDir
+func (capture *capture) screenshot(frame int, pixelData []color.RGBA) error {
+	if err := os.MkdirAll(pngDir, 0755); err != nil {
+		return err
+	}
+	screenshotPath := filepath.Join(pngDir, fmt.Sprintf("screenshot_%06d.png", frame))
+	if err := writePNG(screenshotPath, scaleImage(frameImage(pixelData), captureScale)); err != nil {
+		return err
+	}
+	fmt.Println("Screenshot written to:", screenshotPath)
+	return nil
+}
+
+//the GIF hotkey starts a recording in pngDir or stops the one running
+func (capture *capture) toggleGif(frame int) error {
+	if capture.gif != nil {
+		return capture.stopGif()
+	}
+	if err := os.MkdirAll(pngDir, 0755); err != nil {
+		return err
+	}
+	capture.startGif(filepath.Join(pngDir, fmt.Sprintf("capture_%06d.gif", frame)), frame, 0)
+	return nil
+}
+
+//writes a GIF that is still recording when the game ends
+func (capture *capture) close() error {
+	if capture.pngs > 0 {
+		fmt.Printf("%v frames written to %v\n", capture.pngs, pngDir)
+	}
+	if capture.gif != nil {
+		return capture.stopGif()
+	}
+	return nil
+}
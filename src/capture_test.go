@@ -0,0 +1,106 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPngWanted(t *testing.T) {
+	defer func(frames []int, every int) { pngFrames, pngEvery = frames, every }(pngFrames, pngEvery)
+	pngFrames, pngEvery = []int{7, 30}, 10
+
+	wanted := []int{}
+	for frame := 1; frame <= 30; frame++ {
+		if pngWanted(frame) {
+			wanted = append(wanted, frame)
+		}
+	}
+	if len(wanted) != 4 || wanted[0] != 7 || wanted[1] != 10 || wanted[2] != 20 || wanted[3] != 30 {
+		t.Fatalf("frames %v, want [7 10 20 30]", wanted)
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	pixelData := make([]color.RGBA, frameWidth * frameHeight)
+	pixelData[frameWidth + 2] = color.RGBA{32, 255, 32, 255}
+	framePath := filepath.Join(t.TempDir(), "frame.png")
+	if err := writePNG(framePath, frameImage(pixelData)); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(framePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != frameWidth || bounds.Dy() != frameHeight {
+		t.Fatalf("image is %vx%v", bounds.Dx(), bounds.Dy())
+	}
+	if r, g, _, _ := img.At(2, 1).RGBA(); r >> 8 != 32 || g >> 8 != 255 {
+		t.Fatal("pixel 2,1 lost its colour")
+	}
+}
+
+func TestScaleImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(1, 0, color.RGBA{255, 32, 32, 255})
+	scaled := scaleImage(img, 3)
+	if scaled.Rect.Dx() != 6 || scaled.Rect.Dy() != 3 {
+		t.Fatalf("scaled to %v", scaled.Rect)
+	}
+	if scaled.RGBAAt(2, 2) != img.RGBAAt(0, 0) || scaled.RGBAAt(3, 0) != img.RGBAAt(1, 0) || scaled.RGBAAt(5, 2) != img.RGBAAt(1, 0) {
+		t.Fatal("pixels not copied into 3x3 blocks")
+	}
+}
+
+//a -gif span of 60 frames is one second of GIF with every second frame, in the picture's own colours
+func TestGifSpan(t *testing.T) {
+	defer func(path string, first int, last int) { gifPath, gifFirst, gifLast = path, first, last }(gifPath, gifFirst, gifLast)
+	gifPath, gifFirst, gifLast = filepath.Join(t.TempDir(), "span.gif"), 11, 70
+
+	green := color.RGBA{32, 255, 32, 255}
+	capture := &capture{}
+	pixelData := make([]color.RGBA, frameWidth * frameHeight)
+	for frame := 1; frame <= 100; frame++ {
+		for i := range pixelData {
+			pixelData[i] = color.RGBA{0, 0, 0, 255}
+		}
+		pixelData[frame] = green
+		if err := capture.frame(frame, pixelData); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if capture.gif != nil {
+		t.Fatal("still recording after the end of the span")
+	}
+
+	file, err := os.Open(gifPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	anim, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, delay := range anim.Delay {
+		total += delay
+	}
+	if len(anim.Image) != 30 || total != 100 {
+		t.Fatalf("%v frames lasting %v/100s, want 30 lasting 100", len(anim.Image), total)
+	}
+	//frame 11 lit pixel 11, frame 13 pixel 13...
+	if anim.Image[1].At(13, 0) != green || anim.Image[1].At(11, 0) == green {
+		t.Fatal("second GIF frame is not frame 13")
+	}
+}
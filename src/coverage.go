@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+)
+
+const (
+	coverageOpcode uint8 = 1 << iota //executed as the first byte of an instruction
+	coverageOperand //executed as byte 2 or 3 of an instruction
+	coverageRead //read as data
+)
+
+const coverageRowBytes = 64 //bytes per row in the heat map
+const coverageCellSize = 4 //pixels per byte in the heat map
+
+//code/data coverage, enabled with -coverage <name> and written as <name>.asm and <name>.png at exit
+type coverage struct {
+	flags [65536]uint8
+	counts [65536]uint32 //executions for opcode bytes, reads for data bytes
+}
+
+func (c *coverage) mark(addr uint16, flag uint8) {
+	c.flags[addr] |= flag
+	if flag != coverageOperand && c.counts[addr] < math.MaxUint32 {
+		c.counts[addr]++
+	}
+}
+
+//called before an instruction runs, marks the instruction bytes and the memory it is going to read
+func (c *coverage) record(cpu *cpu) {
+	length := opcodeTable[cpu.opcode].length
+	c.mark(cpu.pc, coverageOpcode)
+	for i := 1; i < length; i++ {
+		c.mark(cpu.pc + uint16(i), coverageOperand)
+	}
+
+	switch cpu.opcode {
+	case 0x46, 0x4E, 0x56, 0x5E, 0x66, 0x6E, 0x7E, //MOV r, M
+		0x86, 0x8E, 0x96, 0x9E, 0xA6, 0xAE, 0xB6, 0xBE, //ALU M
+		0x34, 0x35: //INR M, DCR M
+		c.mark(cpu.get16BitReg("hl"), coverageRead)
+	case 0x0A:
+		c.mark(cpu.get16BitReg("bc"), coverageRead)
+	case 0x1A:
+		c.mark(cpu.get16BitReg("de"), coverageRead)
+	case 0x3A:
+		c.mark(cpu.addr, coverageRead)
+	case 0x2A:
+		c.mark(cpu.addr, coverageRead)
+		c.mark(cpu.addr + 1, coverageRead)
+	case 0xC1, 0xD1, 0xE1, 0xF1, 0xC9, 0xD9, 0xE3: //POP, RET, XTHL
+		c.mark(cpu.sp, coverageRead)
+		c.mark(cpu.sp + 1, coverageRead)
+	case 0xC0, 0xC8, 0xD0, 0xD8, 0xE0, 0xE8, 0xF0, 0xF8: //conditional RET, only reads the stack when taken
+		if cpu.conditionMet(cpu.opcode) {
+			c.mark(cpu.sp, coverageRead)
+			c.mark(cpu.sp + 1, coverageRead)
+		}
+	}
+}
+
+//the condition in bits 3-5 of a conditional jump, call or return: NZ Z NC C PO PE P M
+func (cpu *cpu) conditionMet(opcode uint8) bool {
+	flags := []bool{cpu.zero, cpu.carry, cpu.parity, cpu.sign}
+	condition := opcode >> 3 & 0x07
+	return flags[condition >> 1] == (condition & 1 != 0)
+}
+
+func (cpu *cpu) writeCoverage(name string) {
+	c := cpu.coverage
+	start, end := cpu.romStart, cpu.romEnd
+	if end <= start {
+		start, end = 0, 65536
+	}
+
+	file, err := os.Create(name + ".asm")
+	if err != nil {
+		fmt.Println("Could not write coverage:", err)
+		return
+	}
+	defer file.Close()
+
+	var opcodes, operands, data, untouched int
+	for addr := start; addr < end; addr++ {
+		switch {
+		case c.flags[addr] & coverageOpcode != 0:
+			opcodes++
+		case c.flags[addr] & coverageOperand != 0:
+			operands++
+		case c.flags[addr] & coverageRead != 0:
+			data++
+		default:
+			untouched++
+		}
+	}
+	size := float64(end - start)
+	fmt.Fprintf(file, "; GO-8080 coverage of %04X-%04X (%v bytes)\n", start, end - 1, end - start)
+	fmt.Fprintf(file, "; executed as opcode:  %6v %6.2f%%\n", opcodes, float64(opcodes) * 100 / size)
+	fmt.Fprintf(file, "; executed as operand: %6v %6.2f%%\n", operands, float64(operands) * 100 / size)
+	fmt.Fprintf(file, "; read as data:        %6v %6.2f%%\n", data, float64(data) * 100 / size)
+	fmt.Fprintf(file, "; never touched:       %6v %6.2f%%\n\n", untouched, float64(untouched) * 100 / size)
+
+	for addr := start; addr < end; {
+		flags := c.flags[addr]
+		switch {
+		case flags & coverageOpcode != 0:
+			text, length := cpu.disassemble(uint16(addr))
+			bytes := ""
+			for i := 0; i < length; i++ {
+				bytes += fmt.Sprintf("%02X ", cpu.memory[uint16(addr + i)])
+			}
+			fmt.Fprintf(file, "%04X  %-9v  %-16v ; x%v\n", addr, bytes, text, c.counts[addr])
+			addr += length
+		case flags & coverageRead != 0:
+			fmt.Fprintf(file, "%04X  %-9v  %-16v ; data, read x%v\n", addr, fmt.Sprintf("%02X", cpu.memory[addr]), fmt.Sprintf("DB $%02X", cpu.memory[addr]), c.counts[addr])
+			addr++
+		case flags & coverageOperand != 0:
+			fmt.Fprintf(file, "%04X  %-9v  %-16v ; operand only\n", addr, fmt.Sprintf("%02X", cpu.memory[addr]), fmt.Sprintf("DB $%02X", cpu.memory[addr]))
+			addr++
+		default:
+			//group untouched bytes into one line per 8 bytes
+			bytes := ""
+			n := 0
+			for ; n < 8 && addr + n < end && c.flags[addr + n] == 0; n++ {
+				bytes += fmt.Sprintf("$%02X,", cpu.memory[addr + n])
+			}
+			fmt.Fprintf(file, "%04X  %-9v  DB %-40v ; never touched\n", addr, "", bytes[:len(bytes) - 1])
+			addr += n
+		}
+	}
+	fmt.Println("Coverage disassembly written to:", name + ".asm")
+
+	cpu.writeCoverageHeatMap(name + ".png", start, end)
+}
+
+//one cell per byte: black never touched, red to yellow executed (brighter = more often), orange operand, blue read as data
+func (cpu *cpu) writeCoverageHeatMap(filePath string, start int, end int) {
+	c := cpu.coverage
+	rows := (end - start + coverageRowBytes - 1) / coverageRowBytes
+	img := image.NewRGBA(image.Rect(0, 0, coverageRowBytes * coverageCellSize, rows * coverageCellSize))
+
+	var maxCount uint32 = 1
+	for addr := start; addr < end; addr++ {
+		if c.counts[addr] > maxCount {
+			maxCount = c.counts[addr]
+		}
+	}
+	logMax := math.Log(float64(maxCount) + 1)
+
+	for addr := start; addr < end; addr++ {
+		heat := math.Log(float64(c.counts[addr]) + 1) / logMax
+		cellColor := color.RGBA{0, 0, 0, 255}
+		switch {
+		case c.flags[addr] & coverageOpcode != 0:
+			cellColor = color.RGBA{uint8(128 + 127 * heat), uint8(255 * heat), 0, 255}
+		case c.flags[addr] & coverageOperand != 0:
+			cellColor = color.RGBA{160, 80, 0, 255}
+		case c.flags[addr] & coverageRead != 0:
+			cellColor = color.RGBA{0, uint8(64 + 128 * heat), uint8(128 + 127 * heat), 255}
+		}
+
+		x := (addr - start) % coverageRowBytes * coverageCellSize
+		y := (addr - start) / coverageRowBytes * coverageCellSize
+		for dy := 0; dy < coverageCellSize; dy++ {
+			for dx := 0; dx < coverageCellSize; dx++ {
+				img.Set(x + dx, y + dy, cellColor)
+			}
+		}
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("Could not write coverage heat map:", err)
+		return
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		fmt.Println("Could not write coverage heat map:", err)
+		return
+	}
+	fmt.Println("Coverage heat map written to:", filePath)
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+//a taken conditional return reads its return address off the stack, one not taken reads nothing
+func TestCoverageConditionalReturn(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opcode uint8
+		zero bool
+		read bool
+	}{
+		{"RNZ taken", 0xC0, false, true},
+		{"RNZ not taken", 0xC0, true, false},
+		{"RZ taken", 0xC8, true, true},
+		{"RM not taken", 0xF8, false, false},
+	} {
+		cpu := freshCpu(nil, &coverage{})
+		cpu.memory[0] = test.opcode
+		cpu.sp = 0x2300
+		cpu.zero = test.zero
+		cpu.executeInstruction()
+
+		for _, addr := range []uint16{0x2300, 0x2301} {
+			if read := cpu.coverage.flags[addr] & coverageRead != 0; read != test.read {
+				t.Errorf("%v: stack byte %04X read %v, want %v", test.name, addr, read, test.read)
+			}
+		}
+	}
+}
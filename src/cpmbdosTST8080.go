@@ -1,11 +1,27 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
 
-func (cpu *cpu) cpmBdos() {
-	switch cpu.regs["c"] {
+const cpmMaxInstructions = 10000000 //gives up on programs that never return to CP/M
+
+func (cpu *cpu) cpmBdos(out io.Writer) {
+	switch cpu.regs[regC] {
 	case 0x02:
-		fmt.Printf("%c", cpu.regs["e"])
+		fmt.Fprintf(out, "%c", cpu.regs[regE])
+	case 0x06:
+		//direct console I/O, 0xFF asks for input which we do not have
+		if cpu.regs[regE] != 0xFF {
+			fmt.Fprintf(out, "%c", cpu.regs[regE])
+		} else {
+			cpu.regs[regA] = 0
+		}
+	case 0x0B:
+		//console status, no key waiting
+		cpu.regs[regA] = 0
 	case 0x09:
 		addr := cpu.get16BitReg("de")
 		for {
@@ -13,27 +29,42 @@ func (cpu *cpu) cpmBdos() {
 			if ch == '$' {
 				break
 			}
-			fmt.Printf("%c", ch)
+			fmt.Fprintf(out, "%c", ch)
 			addr+=1
 		}
 	}
 	//cpu.pc++
 }
 
-func (cpu *cpu) runTST8080() {
-		cpu.loadRom("roms/TST8080/TST8080.COM", 0x100)
+//runs a CP/M .COM program until it jumps back to 0x0000 (warm boot) or calls BDOS 0,
+//BDOS console output goes to out, maxInstructions 0 runs without a limit
+func (cpu *cpu) runCpm(romPath string, out io.Writer, maxInstructions int) bool {
+		cpu.loadRom(romPath, 0x100)
 		cpu.pc = 0x0100
 		cpu.memory[0x0000] = 0x76 //HLT
 		cpu.memory[0x0005] = 0xC9 //RET
 
-		for {
+		for i := 0; maxInstructions == 0 || i < maxInstructions; i++ {
 			if cpu.pc == 0x0005 {
-				cpu.cpmBdos()
+				if cpu.regs[regC] == 0x00 {
+					return true
+				}
+				cpu.cpmBdos(out)
 			} else if cpu.pc == 0x0000 {
-				break
+				return true
 			}
 
 			cycles := cpu.executeInstruction()
 			_ = cycles	
+			if cpu.halted {
+				return false
+			}
 		}
-}
\ No newline at end of file
+		return false
+}
+
+func (cpu *cpu) runTST8080() {
+	if !cpu.runCpm("roms/TST8080/TST8080.COM", os.Stdout, cpmMaxInstructions) {
+		fmt.Println("\nTST8080 did not finish")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTST8080(t *testing.T) {
+	var out bytes.Buffer
+	cpu := cpu{}
+	cpu.cpuInit()
+
+	if !cpu.runCpm("../roms/TST8080/TST8080.COM", &out, cpmMaxInstructions) {
+		t.Fatalf("TST8080 did not return to CP/M, output:\n%v", out.String())
+	}
+	if !strings.Contains(out.String(), "CPU IS OPERATIONAL") {
+		t.Fatalf("TST8080 did not report CPU IS OPERATIONAL, output:\n%v", out.String())
+	}
+}
+
+func TestCpmBdosPrintString(t *testing.T) {
+	var out bytes.Buffer
+	cpu := cpu{}
+	cpu.cpuInit()
+	copy(cpu.memory[0x200:], "HELLO$IGNORED")
+	cpu.regs[regC] = 0x09
+	cpu.load16BitReg("de", 0x200)
+
+	cpu.cpmBdos(&out)
+
+	if out.String() != "HELLO" {
+		t.Fatalf("BDOS 9 printed %q, want %q", out.String(), "HELLO")
+	}
+}
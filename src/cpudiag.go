@@ -1,25 +1,31 @@
 package main
 
-import (
-	"fmt"
-	"os"
-)
+import "fmt"
 
-func (cpu *cpu) runCpudiag() {
-		cpu.loadRom("roms/cpudiag/cpudiag.bin", 0x100)
+const cpudiagErrorPC = 0x0689
+const cpudiagSuccessPC = 0x069B
+const cpudiagMaxInstructions = 1000000
 
-		for {
-			if cpu.pc == 0x0689 {
-				//fmt.Println("Error: The test at PC:", fmt.Sprintf("%X", prevPC), "failed")
-				fmt.Println("Error")
-				os.Exit(3)
-			}
-			if cpu.pc == 0x069B {
-				fmt.Println("Success!")
-				os.Exit(3)
+//runs cpudiag until it reaches its error or success address, returns the final pc
+func (cpu *cpu) cpudiag(romPath string) uint16 {
+		cpu.loadRom(romPath, 0x100)
+
+		for i := 0; i < cpudiagMaxInstructions; i++ {
+			if cpu.pc == cpudiagErrorPC || cpu.pc == cpudiagSuccessPC || cpu.halted {
+				break
 			}
 
 			cycles := cpu.executeInstruction()
 			_ = cycles
 		}
-}
\ No newline at end of file
+		return cpu.pc
+}
+
+func (cpu *cpu) runCpudiag() {
+		if cpu.cpudiag("roms/cpudiag/cpudiag.bin") == cpudiagSuccessPC {
+			fmt.Println("Success!")
+			cpu.exit(3)
+		}
+		//fmt.Println("Error: The test at PC:", fmt.Sprintf("%X", prevPC), "failed")
+		cpu.crash("Error", 3)
+}
@@ -0,0 +1,12 @@
+package main
+
+import "testing"
+
+func TestCpudiag(t *testing.T) {
+	cpu := cpu{}
+	cpu.cpuInit()
+
+	if pc := cpu.cpudiag("../roms/cpudiag/cpudiag.bin"); pc != cpudiagSuccessPC {
+		t.Fatalf("cpudiag stopped at PC %04X, want the success address %04X", pc, cpudiagSuccessPC)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const historySize = 256
+const crashReportPath = "crash.txt"
+const crashMemoryPath = "crash.bin"
+
+//cpu state right before an instruction was executed
+type historyEntry struct {
+	pc, sp uint16
+	opcode, byte2, byte3 uint8
+	a, b, c, d, e, h, l uint8
+	zero, sign, parity, carry, ac bool
+}
+
+func (cpu *cpu) recordHistory() {
+	cpu.history[cpu.historyPos] = historyEntry{
+		cpu.pc, cpu.sp,
+		cpu.opcode, cpu.byte2, cpu.byte3,
+		cpu.regs[regA], cpu.regs[regB], cpu.regs[regC], cpu.regs[regD], cpu.regs[regE], cpu.regs[regH], cpu.regs[regL],
+		cpu.zero, cpu.sign, cpu.parity, cpu.carry, cpu.ac,
+	}
+	cpu.historyPos = (cpu.historyPos + 1) % historySize
+	if cpu.historyCount < historySize {
+		cpu.historyCount++
+	}
+}
+
+//prints the reason, writes crash.txt and crash.bin, then exits with the given code
+func (cpu *cpu) crash(reason string, exitCode int) {
+	fmt.Println(reason)
+	cpu.printBacktrace(os.Stdout)
+
+	file, err := os.Create(crashReportPath)
+	if err != nil {
+		fmt.Println("Could not write crash report:", err)
+		cpu.exit(exitCode)
+	}
+
+	fmt.Fprintf(file, "GO-8080 crash report\n%v\n\n", reason)
+	cpu.printRegisters(file)
+	fmt.Fprintln(file)
+	cpu.printBacktrace(file)
+
+	fmt.Fprintf(file, "\nStack from SP:%04X\n", cpu.sp)
+	cpu.printMemory(file, cpu.sp, 64)
+
+	fmt.Fprintf(file, "\nLast %v instructions (oldest first)\n", cpu.historyCount)
+	fmt.Fprintln(file, "PC   OP B2 B3  A  B  C  D  E  H  L  SP   ZSPCA")
+	start := (cpu.historyPos - cpu.historyCount + historySize) % historySize
+	for i := 0; i < cpu.historyCount; i++ {
+		entry := cpu.history[(start + i) % historySize]
+		fmt.Fprintf(file, "%04X %02X %02X %02X  %02X %02X %02X %02X %02X %02X %02X %04X %v%v%v%v%v\n",
+			entry.pc, entry.opcode, entry.byte2, entry.byte3,
+			entry.a, entry.b, entry.c, entry.d, entry.e, entry.h, entry.l, entry.sp,
+			flagBit(entry.zero), flagBit(entry.sign), flagBit(entry.parity), flagBit(entry.carry), flagBit(entry.ac))
+	}
+	file.Close()
+	fmt.Println("Crash report written to:", crashReportPath)
+
+	cpu.dumpMemory(crashMemoryPath)
+	cpu.exit(exitCode)
+}
+
+func flagBit(flag bool) int {
+	if flag {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//simple console debugger, enabled with -g, it pauses before the first instruction
+var debugInput = bufio.NewScanner(os.Stdin)
+var breakpoints = map[uint16]bool{}
+var stepsLeft int = 0 //instructions to run before pausing again, -1 runs until a breakpoint
+
+func (cpu *cpu) debugHook() {
+	if stepsLeft > 0 {
+		stepsLeft--
+	}
+	if stepsLeft < 0 && breakpoints[cpu.pc] {
+		fmt.Printf("Breakpoint at %04X\n", cpu.pc)
+		stepsLeft = 0
+	}
+
+	for stepsLeft == 0 {
+		fmt.Printf("[%04X] %02X > ", cpu.pc, cpu.memory[cpu.pc])
+		if !debugInput.Scan() {
+			//stdin closed, let the program run on its own
+			stepsLeft = -1
+			return
+		}
+		cpu.debugCommand(strings.Fields(debugInput.Text()))
+	}
+}
+
+func (cpu *cpu) debugCommand(fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+
+	switch fields[0] {
+	case "s":
+		stepsLeft = 1
+		if len(fields) > 1 {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 1 {
+				fmt.Println("Usage: s [count]")
+				stepsLeft = 0
+				return
+			}
+			stepsLeft = n
+		}
+	case "c":
+		stepsLeft = -1
+	case "b":
+		addr, ok := parseDebugAddr(fields)
+		if !ok {
+			fmt.Println("Usage: b <hex addr>")
+			return
+		}
+		if breakpoints[addr] {
+			delete(breakpoints, addr)
+			fmt.Printf("Breakpoint removed at %04X\n", addr)
+		} else {
+			breakpoints[addr] = true
+			fmt.Printf("Breakpoint set at %04X\n", addr)
+		}
+	case "sb":
+		n := 1
+		if len(fields) > 1 {
+			n, _ = strconv.Atoi(fields[1])
+		}
+		cpu.stepBack(n)
+	case "rc":
+		cpu.reverseContinue()
+	case "rw":
+		addr, ok := parseDebugAddr(fields)
+		if !ok {
+			fmt.Println("Usage: rw <hex addr>")
+			return
+		}
+		cpu.reverseToWrite(addr)
+	case "r":
+		cpu.printRegisters(os.Stdout)
+	case "bt":
+		cpu.printBacktrace(os.Stdout)
+	case "m":
+		addr, ok := parseDebugAddr(fields)
+		if !ok {
+			fmt.Println("Usage: m <hex addr> [length]")
+			return
+		}
+		length := 64
+		if len(fields) > 2 {
+			length, _ = strconv.Atoi(fields[2])
+		}
+		cpu.printMemory(os.Stdout, addr, length)
+	case "q":
+		cpu.exit(0)
+	default:
+		fmt.Println("Commands: s [n] step, c continue, b <addr> toggle breakpoint, r registers, bt backtrace, m <addr> [len] memory, q quit")
+		fmt.Println("Reverse: sb [n] step back, rc reverse continue to a breakpoint, rw <addr> back to the last write of addr")
+	}
+}
+
+func parseDebugAddr(fields []string) (uint16, bool) {
+	if len(fields) < 2 {
+		return 0, false
+	}
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(fields[1]), "0x"), 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(addr), true
+}
+
+func (cpu *cpu) printRegisters(w io.Writer) {
+	fmt.Fprintf(w, "A:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X\n",
+		cpu.regs[regA], cpu.regs[regB], cpu.regs[regC], cpu.regs[regD], cpu.regs[regE], cpu.regs[regH], cpu.regs[regL], cpu.sp, cpu.pc)
+	fmt.Fprintf(w, "Z:%v S:%v P:%v CY:%v AC:%v INTE:%v\n", cpu.zero, cpu.sign, cpu.parity, cpu.carry, cpu.ac, cpu.interruptEnable)
+}
+
+func (cpu *cpu) printMemory(w io.Writer, addr uint16, length int) {
+	for i := 0; i < length; i += 16 {
+		fmt.Fprintf(w, "%04X:", addr + uint16(i))
+		for j := i; j < i + 16 && j < length; j++ {
+			fmt.Fprintf(w, " %02X", cpu.memory[addr + uint16(j)])
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+)
+
+//determinism checker: two Space Invaders machines run in lockstep from power-on with the same
+//input log, the state is compared after every frame and the first difference is reported
+const determinismFrames = 3600 //one minute of play
+const determinismSeed = 8080
+
+type stateField struct {
+	name string
+	value []byte
+}
+
+//everything that decides what the machine does next, in a fixed order
+func (cpu *cpu) stateFields() []stateField {
+	word := func(value uint16) []byte { return []byte{uint8(value >> 8), uint8(value)} }
+	return []stateField{
+		{"A", []byte{cpu.regs[regA]}},
+		{"B", []byte{cpu.regs[regB]}},
+		{"C", []byte{cpu.regs[regC]}},
+		{"D", []byte{cpu.regs[regD]}},
+		{"E", []byte{cpu.regs[regE]}},
+		{"H", []byte{cpu.regs[regH]}},
+		{"L", []byte{cpu.regs[regL]}},
+		{"PC", word(cpu.pc)},
+		{"SP", word(cpu.sp)},
+		{"flags", []byte{cpu.flagsByte()}},
+		{"interruptEnable", []byte{uint8(flagBit(cpu.interruptEnable))}},
+		{"halted", []byte{uint8(flagBit(cpu.halted))}},
+		{"shiftReg1", []byte{cpu.shiftReg1}},
+		{"shiftReg2", []byte{cpu.shiftReg2}},
+		{"shiftOffset", []byte{cpu.shiftOffset}},
+		{"port1", []byte{cpu.port1}},
+		{"port2", []byte{cpu.port2}},
+		{"dipSwitches", []byte{cpu.dipSwitches}},
+		{"cocktail", []byte{uint8(flagBit(cpu.cocktail))}},
+		{"port3Out", []byte{cpu.port3Out}},
+		{"port5Out", []byte{cpu.port5Out}},
+		{"watchdogFrames", word(uint16(cpu.watchdogFrames))},
+		{"coinCount", word(uint16(cpu.coinCount))},
+		{"videoCycles", []byte(fmt.Sprint(cpu.videoCycles))},
+		{"memory", cpu.memory[:]},
+		{"callStack", []byte(fmt.Sprint(cpu.callStack))},
+	}
+}
+
+func (cpu *cpu) stateHash() string {
+	hash := sha256.New()
+	for _, field := range cpu.stateFields() {
+		hash.Write(field.value)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))[:16]
+}
+
+//first field that differs between two machines, empty if they are the same
+func diffState(a *cpu, b *cpu) string {
+	fieldsA, fieldsB := a.stateFields(), b.stateFields()
+	for i := range fieldsA {
+		valueA, valueB := fieldsA[i].value, fieldsB[i].value
+		if bytes.Equal(valueA, valueB) {
+			continue
+		}
+		if fieldsA[i].name == "memory" {
+			for addr := range valueA {
+				if valueA[addr] != valueB[addr] {
+					return fmt.Sprintf("memory[%04X]: %02X vs %02X", addr, valueA[addr], valueB[addr])
+				}
+			}
+		}
+		if fieldsA[i].name == "callStack" {
+			return fmt.Sprintf("callStack: %v vs %v", string(valueA), string(valueB))
+		}
+		return fmt.Sprintf("%v: %X vs %X", fieldsA[i].name, valueA, valueB)
+	}
+	return ""
+}
+
+//a reproducible input log: coin, 1P start, then fire and movement changing every few frames for
+//both players, so port 2 is driven as well as port 1
+func determinismInputs(frames int, seed int64) []frameInput {
+	random := rand.New(rand.NewSource(seed))
+	inputs := make([]frameInput, frames)
+	var held frameInput
+	controls := []uint8{0, 0x10, 0x20, 0x40, 0x30, 0x50}
+	for frame := range inputs {
+		switch {
+		case frame >= 60 && frame < 64:
+			inputs[frame].port1 = 0x01 //coin
+		case frame >= 120 && frame < 124:
+			inputs[frame].port1 = 0x04 //1P start
+		case frame >= 180:
+			if random.Intn(20) == 0 {
+				held.port1 = controls[random.Intn(len(controls))]
+			}
+			if random.Intn(20) == 0 {
+				held.port2 = controls[random.Intn(len(controls))]
+			}
+			inputs[frame] = held
+		}
+	}
+	return inputs
+}
+
+//runs two machines side by side, returns the first frame where they differ and what differs,
+//frame is -1 when every frame matched, hash is the state hash after the last compared frame
+func checkDeterminism(romPath string, inputs []frameInput) (frame int, field string, hash string) {
+	a, b := freshCpu(nil, nil), freshCpu(nil, nil)
+	a.loadSpaceInvaders(romPath)
+	b.loadSpaceInvaders(romPath)
+
+	hash = a.stateHash()
+	for frame, input := range inputs {
+		a.setInputs(input)
+		b.setInputs(input)
+		a.runFrame()
+		b.runFrame()
+
+		hash = a.stateHash()
+		if hash != b.stateHash() {
+			return frame + 1, diffState(&a, &b), hash
+		}
+	}
+	return -1, "", hash
+}
+
+func (cpu *cpu) runDeterminismCommand(frames int) {
+	fmt.Printf("Running Space Invaders twice for %v frames with the same inputs\n", frames)
+	frame, field, hash := checkDeterminism("roms/invaders/invaders.rom", determinismInputs(frames, determinismSeed))
+	if frame >= 0 {
+		fmt.Printf("Runs diverged at frame %v, first difference %v\n", frame, field)
+		cpu.exit(1)
+	}
+	fmt.Printf("Deterministic, state hash after frame %v: %v\n", frames, hash)
+	cpu.exit(0)
+}
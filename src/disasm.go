@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type opcodeInfo struct {
+	mnemonic string //d8, d16 and addr are replaced by the operand bytes
+	length int
+}
+
+//all 256 opcodes, undocumented ones are marked with *
+var opcodeTable = [256]opcodeInfo{
+	{"NOP", 1}, {"LXI B,d16", 3}, {"STAX B", 1}, {"INX B", 1},
+	{"INR B", 1}, {"DCR B", 1}, {"MVI B,d8", 2}, {"RLC", 1},
+	{"*NOP", 1}, {"DAD B", 1}, {"LDAX B", 1}, {"DCX B", 1},
+	{"INR C", 1}, {"DCR C", 1}, {"MVI C,d8", 2}, {"RRC", 1},
+	{"*NOP", 1}, {"LXI D,d16", 3}, {"STAX D", 1}, {"INX D", 1},
+	{"INR D", 1}, {"DCR D", 1}, {"MVI D,d8", 2}, {"RAL", 1},
+	{"*NOP", 1}, {"DAD D", 1}, {"LDAX D", 1}, {"DCX D", 1},
+	{"INR E", 1}, {"DCR E", 1}, {"MVI E,d8", 2}, {"RAR", 1},
+	{"*NOP", 1}, {"LXI H,d16", 3}, {"SHLD addr", 3}, {"INX H", 1},
+	{"INR H", 1}, {"DCR H", 1}, {"MVI H,d8", 2}, {"DAA", 1},
+	{"*NOP", 1}, {"DAD H", 1}, {"LHLD addr", 3}, {"DCX H", 1},
+	{"INR L", 1}, {"DCR L", 1}, {"MVI L,d8", 2}, {"CMA", 1},
+	{"*NOP", 1}, {"LXI SP,d16", 3}, {"STA addr", 3}, {"INX SP", 1},
+	{"INR M", 1}, {"DCR M", 1}, {"MVI M,d8", 2}, {"STC", 1},
+	{"*NOP", 1}, {"DAD SP", 1}, {"LDA addr", 3}, {"DCX SP", 1},
+	{"INR A", 1}, {"DCR A", 1}, {"MVI A,d8", 2}, {"CMC", 1},
+	{"MOV B,B", 1}, {"MOV B,C", 1}, {"MOV B,D", 1}, {"MOV B,E", 1},
+	{"MOV B,H", 1}, {"MOV B,L", 1}, {"MOV B,M", 1}, {"MOV B,A", 1},
+	{"MOV C,B", 1}, {"MOV C,C", 1}, {"MOV C,D", 1}, {"MOV C,E", 1},
+	{"MOV C,H", 1}, {"MOV C,L", 1}, {"MOV C,M", 1}, {"MOV C,A", 1},
+	{"MOV D,B", 1}, {"MOV D,C", 1}, {"MOV D,D", 1}, {"MOV D,E", 1},
+	{"MOV D,H", 1}, {"MOV D,L", 1}, {"MOV D,M", 1}, {"MOV D,A", 1},
+	{"MOV E,B", 1}, {"MOV E,C", 1}, {"MOV E,D", 1}, {"MOV E,E", 1},
+	{"MOV E,H", 1}, {"MOV E,L", 1}, {"MOV E,M", 1}, {"MOV E,A", 1},
+	{"MOV H,B", 1}, {"MOV H,C", 1}, {"MOV H,D", 1}, {"MOV H,E", 1},
+	{"MOV H,H", 1}, {"MOV H,L", 1}, {"MOV H,M", 1}, {"MOV H,A", 1},
+	{"MOV L,B", 1}, {"MOV L,C", 1}, {"MOV L,D", 1}, {"MOV L,E", 1},
+	{"MOV L,H", 1}, {"MOV L,L", 1}, {"MOV L,M", 1}, {"MOV L,A", 1},
+	{"MOV M,B", 1}, {"MOV M,C", 1}, {"MOV M,D", 1}, {"MOV M,E", 1},
+	{"MOV M,H", 1}, {"MOV M,L", 1}, {"HLT", 1}, {"MOV M,A", 1},
+	{"MOV A,B", 1}, {"MOV A,C", 1}, {"MOV A,D", 1}, {"MOV A,E", 1},
+	{"MOV A,H", 1}, {"MOV A,L", 1}, {"MOV A,M", 1}, {"MOV A,A", 1},
+	{"ADD B", 1}, {"ADD C", 1}, {"ADD D", 1}, {"ADD E", 1},
+	{"ADD H", 1}, {"ADD L", 1}, {"ADD M", 1}, {"ADD A", 1},
+	{"ADC B", 1}, {"ADC C", 1}, {"ADC D", 1}, {"ADC E", 1},
+	{"ADC H", 1}, {"ADC L", 1}, {"ADC M", 1}, {"ADC A", 1},
+	{"SUB B", 1}, {"SUB C", 1}, {"SUB D", 1}, {"SUB E", 1},
+	{"SUB H", 1}, {"SUB L", 1}, {"SUB M", 1}, {"SUB A", 1},
+	{"SBB B", 1}, {"SBB C", 1}, {"SBB D", 1}, {"SBB E", 1},
+	{"SBB H", 1}, {"SBB L", 1}, {"SBB M", 1}, {"SBB A", 1},
+	{"ANA B", 1}, {"ANA C", 1}, {"ANA D", 1}, {"ANA E", 1},
+	{"ANA H", 1}, {"ANA L", 1}, {"ANA M", 1}, {"ANA A", 1},
+	{"XRA B", 1}, {"XRA C", 1}, {"XRA D", 1}, {"XRA E", 1},
+	{"XRA H", 1}, {"XRA L", 1}, {"XRA M", 1}, {"XRA A", 1},
+	{"ORA B", 1}, {"ORA C", 1}, {"ORA D", 1}, {"ORA E", 1},
+	{"ORA H", 1}, {"ORA L", 1}, {"ORA M", 1}, {"ORA A", 1},
+	{"CMP B", 1}, {"CMP C", 1}, {"CMP D", 1}, {"CMP E", 1},
+	{"CMP H", 1}, {"CMP L", 1}, {"CMP M", 1}, {"CMP A", 1},
+	{"RNZ", 1}, {"POP B", 1}, {"JNZ addr", 3}, {"JMP addr", 3},
+	{"CNZ addr", 3}, {"PUSH B", 1}, {"ADI d8", 2}, {"RST 0", 1},
+	{"RZ", 1}, {"RET", 1}, {"JZ addr", 3}, {"*JMP addr", 3},
+	{"CZ addr", 3}, {"CALL addr", 3}, {"ACI d8", 2}, {"RST 1", 1},
+	{"RNC", 1}, {"POP D", 1}, {"JNC addr", 3}, {"OUT d8", 2},
+	{"CNC addr", 3}, {"PUSH D", 1}, {"SUI d8", 2}, {"RST 2", 1},
+	{"RC", 1}, {"*RET", 1}, {"JC addr", 3}, {"IN d8", 2},
+	{"CC addr", 3}, {"*CALL addr", 3}, {"SBI d8", 2}, {"RST 3", 1},
+	{"RPO", 1}, {"POP H", 1}, {"JPO addr", 3}, {"XTHL", 1},
+	{"CPO addr", 3}, {"PUSH H", 1}, {"ANI d8", 2}, {"RST 4", 1},
+	{"RPE", 1}, {"PCHL", 1}, {"JPE addr", 3}, {"XCHG", 1},
+	{"CPE addr", 3}, {"*CALL addr", 3}, {"XRI d8", 2}, {"RST 5", 1},
+	{"RP", 1}, {"POP PSW", 1}, {"JP addr", 3}, {"DI", 1},
+	{"CP addr", 3}, {"PUSH PSW", 1}, {"ORI d8", 2}, {"RST 6", 1},
+	{"RM", 1}, {"SPHL", 1}, {"JM addr", 3}, {"EI", 1},
+	{"CM addr", 3}, {"*CALL addr", 3}, {"CPI d8", 2}, {"RST 7", 1},
+}
+
+//returns the instruction at addr as text and its length in bytes
+func (cpu *cpu) disassemble(addr uint16) (string, int) {
+	info := opcodeTable[cpu.memory[addr]]
+	byte2 := cpu.memory[addr + 1]
+	word := uint16(byte2) | uint16(cpu.memory[addr + 2]) << 8
+
+	text := info.mnemonic
+	text = strings.Replace(text, "d16", fmt.Sprintf("$%04X", word), 1)
+	text = strings.Replace(text, "addr", fmt.Sprintf("$%04X", word), 1)
+	text = strings.Replace(text, "d8", fmt.Sprintf("#$%02X", byte2), 1)
+	return text, info.length
+}
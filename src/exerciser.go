@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//CP/M instruction exercisers (8080PRE.COM, 8080EXM.COM, CPUTEST.COM) supplied as local files, run with -x <file>
+
+type exerciserResult struct {
+	name string
+	passed bool
+	crc string //crc found, for a failed group this is the one that did not match
+	expected string //crc expected, only set for a failed group
+}
+
+var exerciserPassed = regexp.MustCompile(`^(.*?)\.{2,}\s*PASSED! crc is:\s*([0-9a-fA-F]+)`)
+var exerciserFailed = regexp.MustCompile(`^(.*?)\.{2,}\s*ERROR \**\s*crc expected:\s*([0-9a-fA-F]+)\s*found:\s*([0-9a-fA-F]+)`)
+
+//strings printed when a whole program passes/fails, for exercisers that do not report groups
+var exerciserSuccess = []string{"Preliminary tests complete", "CPU TESTS OK"}
+var exerciserFailure = []string{"ERROR", "FAIL"}
+
+//per-group results from the 8080EXM style "name.... PASSED! crc is:xxxxxxxx" lines
+func parseExerciserOutput(output string) []exerciserResult {
+	results := []exerciserResult{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if m := exerciserPassed.FindStringSubmatch(line); m != nil {
+			results = append(results, exerciserResult{strings.TrimSpace(m[1]), true, strings.ToLower(m[2]), ""})
+		} else if m := exerciserFailed.FindStringSubmatch(line); m != nil {
+			results = append(results, exerciserResult{strings.TrimSpace(m[1]), false, strings.ToLower(m[3]), strings.ToLower(m[2])})
+		}
+	}
+	return results
+}
+
+//overall verdict: every group passed, or for programs without groups a success message and no error
+func exerciserVerdict(output string, results []exerciserResult) bool {
+	if len(results) > 0 {
+		for _, result := range results {
+			if !result.passed {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, failure := range exerciserFailure {
+		if strings.Contains(output, failure) {
+			return false
+		}
+	}
+	for _, success := range exerciserSuccess {
+		if strings.Contains(output, success) {
+			return true
+		}
+	}
+	return false
+}
+
+//runs the exerciser with its console output shown live, returns the overall verdict
+func (cpu *cpu) runExerciser(romPath string, out io.Writer) bool {
+	var output bytes.Buffer
+	finished := cpu.runCpm(romPath, io.MultiWriter(out, &output), 0)
+	results := parseExerciserOutput(output.String())
+	passed := finished && exerciserVerdict(output.String(), results)
+
+	fmt.Fprintln(out)
+	if len(results) > 0 {
+		passedGroups := 0
+		for _, result := range results {
+			if result.passed {
+				passedGroups++
+				fmt.Fprintf(out, "PASS  %-32v crc %v\n", result.name, result.crc)
+			} else {
+				fmt.Fprintf(out, "FAIL  %-32v crc expected %v, found %v\n", result.name, result.expected, result.crc)
+			}
+		}
+		fmt.Fprintf(out, "%v/%v groups passed\n", passedGroups, len(results))
+	}
+	if passed {
+		fmt.Fprintln(out, "Exerciser passed:", romPath)
+	} else {
+		fmt.Fprintln(out, "Exerciser failed:", romPath)
+	}
+	return passed
+}
+
+func (cpu *cpu) runExerciserCommand(romPath string) {
+	if cpu.runExerciser(romPath, os.Stdout) {
+		cpu.exit(0)
+	}
+	cpu.exit(1)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+const sampleExmOutput = "8080 instruction exerciser\r\n" +
+	"dad <b,d,h,sp>................  PASSED! crc is:14474ba6\r\n" +
+	"aluop nn......................  ERROR **** crc expected:9e922f9e found:c2e45f94\r\n" +
+	"Tests complete$"
+
+func TestParseExerciserOutput(t *testing.T) {
+	results := parseExerciserOutput(sampleExmOutput)
+	want := []exerciserResult{
+		{"dad <b,d,h,sp>", true, "14474ba6", ""},
+		{"aluop nn", false, "c2e45f94", "9e922f9e"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %v groups, want %v: %+v", len(results), len(want), results)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("group %v: got %+v, want %+v", i, results[i], want[i])
+		}
+	}
+	if exerciserVerdict(sampleExmOutput, results) {
+		t.Errorf("verdict passed with a failed group")
+	}
+}
+
+func TestExerciserVerdictWithoutGroups(t *testing.T) {
+	if !exerciserVerdict("8080 Preliminary tests complete", nil) {
+		t.Errorf("8080PRE success was not recognised")
+	}
+	if exerciserVerdict("CPU HAS FAILED! ERROR EXIT=01", nil) {
+		t.Errorf("CPUTEST failure was reported as a pass")
+	}
+	if exerciserVerdict("", nil) {
+		t.Errorf("empty output was reported as a pass")
+	}
+}
+
+//the exercisers are not part of the repository, drop them in roms/exercisers to run them
+func TestExercisers(t *testing.T) {
+	for _, name := range []string{"8080PRE.COM", "CPUTEST.COM", "8080EXM.COM"} {
+		t.Run(name, func(t *testing.T) {
+			romPath := "../roms/exercisers/" + name
+			if _, err := os.Stat(romPath); err != nil {
+				t.Skip("exerciser not found:", romPath)
+			}
+			if name == "8080EXM.COM" && testing.Short() {
+				t.Skip("8080EXM takes a while, skipped in -short mode")
+			}
+
+			cpu := cpu{}
+			cpu.cpuInit()
+			if !cpu.runExerciser(romPath, io.Discard) {
+				t.Fatalf("%v failed, run it with -x for the per-group results", name)
+			}
+		})
+	}
+}
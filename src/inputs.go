@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//input scripts for -headless: one line per stretch of frames and the buttons held down in it,
+//frames count from 1 like -png, later lines add to earlier ones, for example:
+//
+//	# frames  buttons
+//	60-63     coin
+//	120-123   start1
+//	180-400   right fire
+//
+//-record writes the same format from a game played in the window, one line per change of
+//buttons, so a recorded movie can be replayed headless
+
+type frameInput struct {
+	port1, port2 uint8
+}
+
+//button names and the port bits they set, port 2 buttons have 0x100 added
+var inputButtons = map[string]uint16{
+	"coin": 0x01,
+	"start2": 0x02,
+	"start1": 0x04,
+	"fire": 0x10,
+	"left": 0x20,
+	"right": 0x40,
+	"tilt": 0x104,
+	"p2fire": 0x110,
+	"p2left": 0x120,
+	"p2right": 0x140,
+}
+
+//the buttons in the order -record writes them
+var inputButtonOrder = []string{"coin", "start1", "start2", "fire", "left", "right", "p2fire", "p2left", "p2right", "tilt"}
+
+func (input *frameInput) press(button uint16) {
+	if button & 0x100 != 0 {
+		input.port2 |= uint8(button)
+	} else {
+		input.port1 |= uint8(button)
+	}
+}
+
+func (input frameInput) buttons() []string {
+	names := []string{}
+	for _, name := range inputButtonOrder {
+		button := inputButtons[name]
+		port := input.port1
+		if button & 0x100 != 0 {
+			port = input.port2
+		}
+		if port & uint8(button) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+//the buttons held down for the next frame, the same for the keyboard, scripts and the determinism check
+func (cpu *cpu) setInputs(input frameInput) {
+	cpu.port1, cpu.port2 = input.port1, input.port2
+}
+
+//the inputs for frames 1...frames from a script, frames past its last line have nothing pressed
+func readInputScript(scriptPath string, frames int) ([]frameInput, error) {
+	data, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]frameInput, frames)
+	for n, line := range strings.Split(string(data), "\n") {
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		first, last, err := parseFrameRange(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%v line %v: %v", scriptPath, n + 1, err)
+		}
+		var input frameInput
+		for _, name := range fields[1:] {
+			button, ok := inputButtons[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("%v line %v: unknown button %v", scriptPath, n + 1, name)
+			}
+			input.press(button)
+		}
+		for frame := first; frame <= last && frame <= frames; frame++ {
+			inputs[frame - 1].port1 |= input.port1
+			inputs[frame - 1].port2 |= input.port2
+		}
+	}
+	return inputs, nil
+}
+
+//"N" or "N-M", frames count from 1
+func parseFrameRange(text string) (int, int, error) {
+	firstText, lastText, found := strings.Cut(text, "-")
+	if !found {
+		lastText = firstText
+	}
+	first, err1 := strconv.Atoi(firstText)
+	last, err2 := strconv.Atoi(lastText)
+	if err1 != nil || err2 != nil || first < 1 || last < first {
+		return 0, 0, fmt.Errorf("bad frame range %v", text)
+	}
+	return first, last, nil
+}
+
+//the script for a recorded game, one line for every run of frames with the same buttons down
+func formatInputScript(inputs []frameInput) string {
+	var script strings.Builder
+	script.WriteString("# frames  buttons\n")
+	for first := 0; first < len(inputs); {
+		last := first
+		for last + 1 < len(inputs) && inputs[last + 1] == inputs[first] {
+			last++
+		}
+		if buttons := inputs[first].buttons(); len(buttons) > 0 {
+			if first == last {
+				fmt.Fprintf(&script, "%v %v\n", first + 1, strings.Join(buttons, " "))
+			} else {
+				fmt.Fprintf(&script, "%v-%v %v\n", first + 1, last + 1, strings.Join(buttons, " "))
+			}
+		}
+		first = last + 1
+	}
+	return script.String()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInputScript(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "inputs.txt")
+	os.WriteFile(scriptPath, []byte("# a game\n2-3 coin\n3 fire   # held with the coin\n5 P2Left tilt\n\n9-20 right\n"), 0644)
+	inputs, err := readInputScript(scriptPath, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []frameInput{{}, {0x01, 0}, {0x11, 0}, {}, {0, 0x24}, {}, {}, {}, {0x40, 0}, {0x40, 0}}
+	for i := range want {
+		if inputs[i] != want[i] {
+			t.Errorf("frame %v: %+v, want %+v", i + 1, inputs[i], want[i])
+		}
+	}
+
+	//a recording reads back as the same inputs
+	recordedPath := filepath.Join(t.TempDir(), "recorded.txt")
+	os.WriteFile(recordedPath, []byte(formatInputScript(inputs)), 0644)
+	replayed, err := readInputScript(recordedPath, len(inputs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range inputs {
+		if replayed[i] != inputs[i] {
+			t.Fatalf("recorded script\n%v\nreplays frame %v as %+v, want %+v", formatInputScript(inputs), i + 1, replayed[i], inputs[i])
+		}
+	}
+
+	for _, line := range []string{"0 coin", "5-2 coin", "x fire", "3 jump"} {
+		os.WriteFile(scriptPath, []byte(line + "\n"), 0644)
+		if _, err := readInputScript(scriptPath, 10); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("%q: expected an error for line 1, got %v", line, err)
+		}
+	}
+}
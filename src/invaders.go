@@ -1,147 +1,259 @@
 package main
 
 import (
-	"github.com/gen2brain/raylib-go/raylib"
+	"fmt"
 	"image/color"
 )
 
-const cycleMax = 33000
-const firstInterruptCycles = cycleMax / 2
-const secondInterruptCycles = cycleMax
+//video timing: 60 frames a second of 262 scanlines, the first 224 drawn. The monitor is on its
+//side, so a scanline is one 32 byte VRAM row, a column of the upright picture. RST 1 comes when the
+//beam reaches scanline 96 and RST 2 at the start of vblank, scanline 224
+const frameRate = 60
+const scanlinesPerFrame = 262
+const midScreenScanline = 96
+const vblankScanline = 224
+
+//an interrupt puts an RST on the bus, which takes as long as the RST instruction
+const interruptCycles = 11
+
+//size of the rotated framebuffer filled by updateScreenBuffer
+const frameWidth = 224
+const frameHeight = 256
 
 func (cpu *cpu) executeInterrupt(interruptNumber uint8) {
+	if debugger && cpu.behindPresent() {
+		//the debugger rewound, interrupts are replayed from its log until we are back at the present
+		return
+	}
+	cpu.interrupt(interruptNumber)
+}
+
+func (cpu *cpu) interrupt(interruptNumber uint8) {
 	if cpu.interruptEnable == true {
 		cpu.memory[cpu.sp - 1] = uint8(cpu.pc >> 8)
 		cpu.memory[cpu.sp - 2] = uint8(cpu.pc & 0xFF)
 		cpu.sp -= 2
 
+		var target uint16
 		switch interruptNumber {
 		case 1:
-			cpu.pc = 0x08
+			target = 0x08
 		case 2:
-			cpu.pc = 0x10
+			target = 0x10
 		}
+		cpu.pushCallFrame(fmt.Sprintf("INT %v", interruptNumber), target, cpu.pc)
+		cpu.pc = target
 
 		cpu.interruptEnable = false
+		cpu.halted = false
+		cpu.cycles += interruptCycles
+		cpu.videoCycles += interruptCycles
+
+		if debugger {
+			cpu.recordInterrupt(interruptNumber)
+			cpu.advanceTimeline()
+		}
+	}
+}
+
+//DIP switch bits on port 2: ships per game 3-6 (bits 0-1), extra ship at 1000 points instead of 1500 (bit 3),
+//coin info hidden in the demo (bit 7)
+func dipSwitchBits(ships int, bonusLife int, coinInfo bool) uint8 {
+	bits := uint8(min(max(ships, 3), 6) - 3)
+	if bonusLife == 1000 {
+		bits |= 0x08
+	}
+	if !coinInfo {
+		bits |= 0x80
 	}
+	return bits
 }
 
 func (cpu *cpu) portsIN(port uint8)  {
 	switch port {
+		case 0:
+			//only read by the cocktail/other variants: bits 1-3 = 1, bits 4-6 = player 1 shot, left, right
+			cpu.regs[regA] = 0x0E | cpu.port1 & 0x70
 		case 1:
-			//port 1 player 1 input
-			var port1Bits uint8 = 0x08 //bit 3 = 1
-			if rl.IsKeyPressed(rl.KeyC) {      
-				port1Bits |= 0x01 //bit 0 = CREDIT (1 if deposit)
-			}
-			if rl.IsKeyPressed(rl.KeyX) {       
-				port1Bits |= 0x04 //bit 2 = 1P start (1 if pressed)
-			}
-			if rl.IsKeyDown(rl.KeySpace) {        
-				port1Bits |= 0x10 //bit 4 = 1P shot (1 if pressed)
-			}
-			if rl.IsKeyDown(rl.KeyLeft) {        
-				port1Bits |= 0x20 //bit 5 = 1P left (1 if pressed)
-			}
-			if rl.IsKeyDown(rl.KeyRight) {       
-				port1Bits |= 0x40 //bit 6 = 1P right (1 if pressed)
+			cpu.regs[regA] = cpu.port1 | 0x08 //bit 3 = 1
+		case 2:
+			//an upright cabinet has one set of controls that both players share, so player 2's keys only
+			//do anything on a cocktail table
+			controls := cpu.port1 & 0x70
+			if cpu.cocktail {
+				controls = cpu.port2 & 0x70
 			}
-			cpu.regs["a"] = port1Bits
+			cpu.regs[regA] = cpu.dipSwitches | cpu.port2 & 0x04 | controls
 		case 3:
 			shiftValue := uint16(cpu.shiftReg2)<<8 | uint16(cpu.shiftReg1)
-        	cpu.regs["a"] = uint8((shiftValue >> (8 - cpu.shiftOffset)) & 0xFF)
+        	cpu.regs[regA] = uint8((shiftValue >> (8 - cpu.shiftOffset)) & 0xFF)
 		default:
-			cpu.regs["a"] = 0
+			cpu.regs[regA] = 0
 	}
 }
 
 func (cpu *cpu) portsOUT(port uint8) {
 	switch port {
 		case 2:
-			cpu.shiftOffset = cpu.regs["a"] & 0x07
+			cpu.shiftOffset = cpu.regs[regA] & 0x07
+		case 3:
+			cpu.logOutputBits(port, cpu.port3Out, cpu.regs[regA])
+			cpu.soundOut(port, cpu.regs[regA])
+		case 5:
+			cpu.logOutputBits(port, cpu.port5Out, cpu.regs[regA])
+			cpu.soundOut(port, cpu.regs[regA])
+		case 6:
+			cpu.kickWatchdog()
 		case 4:
 			cpu.shiftReg2 = cpu.shiftReg1
-        	cpu.shiftReg1 = cpu.regs["a"]
+        	cpu.shiftReg1 = cpu.regs[regA]
 		default:
-			//cpu.regs["a"] = 0
+			//cpu.regs[regA] = 0
 	}
 }
 
+//port 5 bit 5, the game sets it during player 2's turn, only wired up in cocktail cabinets
+func (cpu *cpu) screenFlipped() bool {
+	return cpu.cocktail && cpu.port5Out & 0x20 != 0
+}
+
+//draws the whole picture from VRAM as it is now
 func (cpu *cpu) updateScreenBuffer(pixelData []color.RGBA) {
+	cpu.drawScanlines(pixelData, 0, vblankScanline)
+}
+
+//draws scanlines first to last-1, which are columns of the upright picture
+func (cpu *cpu) drawScanlines(pixelData []color.RGBA, first int, last int) {
 	vramStart := 0x2400
 	screenWidth := 224
 	screenHeight := 256
+	flipped := cpu.screenFlipped()
 
 	for y := 0; y < screenHeight; y++ {
-		for x := 0; x < screenWidth; x++ {
+		for x := first; x < last; x++ {
 			byteIndex := vramStart + (y / 8) + ((x) * 32)
 			bitIndex := uint8(y % 8)
 
 			pixelColor := (cpu.memory[byteIndex] >> bitIndex) & 0x01
 
+			pixelIndex := (screenHeight-y-1)*screenWidth+x
+			if flipped {
+				pixelIndex = y*screenWidth+(screenWidth-x-1)
+			}
+
+			//the overlay is stuck on the glass, so it does not flip with the picture
 			colorValue := color.RGBA{0, 0, 0, 255}
-			if pixelColor > 0 {
+			if pixelColor > 0 && cpu.overlay != nil {
+				colorValue = cpu.overlay[pixelIndex]
+			} else if pixelColor > 0 {
 				colorValue = color.RGBA{255, 255, 255, 255}
 			}
 
-			pixelData[(screenHeight-y-1)*screenWidth+x] = colorValue
+			pixelData[pixelIndex] = colorValue
 		}
 	}
 }
 
-func (cpu *cpu) playSpaceInvaders() {
+func (cpu *cpu) loadSpaceInvaders(romPath string) {
 	cpu.interruptEnable = true
 
-	cpu.loadRom("roms/invaders/invaders.rom", 0x0000)
-
-	screenWidth := 224 * scale
-	screenHeight := 256 * scale
-	rl.InitWindow(int32(screenWidth), int32(screenHeight), "SPACE INVADERS (GO-8080 EMU)")
-	defer rl.CloseWindow()
+	cpu.loadRom(romPath, 0x0000)
+}
 
-	rl.SetTargetFPS(60)
+//loads the ROM and sets up the cabinet from the command line settings
+func (cpu *cpu) setupSpaceInvaders() {
+	cpu.loadSpaceInvaders("roms/invaders/invaders.rom")
+	cpu.dipSwitches = dipSwitchBits(ships, bonusLife, coinInfo)
+	cpu.cocktail = cabinet == "cocktail"
 
-	textureWidth := 224
-	textureHeight := 256
-	screenImage := rl.GenImageColor(int(textureWidth), int(textureHeight), rl.Black)
-	screenTexture := rl.LoadTextureFromImage(screenImage)
-	defer rl.UnloadTexture(screenTexture)
-	defer rl.UnloadImage(screenImage)
+	var err error
+	if cpu.overlay, err = loadOverlay(overlayName); err != nil {
+		fmt.Println("Could not load overlay:", err)
+		cpu.exit(1)
+	}
+}
 
-	//buffer to hold the pixel data
-	pixelData := make([]color.RGBA, textureWidth*textureHeight)
+//runs one 60Hz frame following the beam: the part of the picture above a scanline is drawn into
+//cpu.framebuffer (when there is one) as the beam passes it, just before the interrupt there, so the
+//game's updates to each half of the screen show up the way they did on the monitor
+func (cpu *cpu) runFrame() {
+	cpu.followsBeam = true
+	cpu.countCoinSwitch()
 
-	for !rl.WindowShouldClose() {
-		rl.BeginDrawing()
-		rl.ClearBackground(rl.Black)
-		totalCycles := 0
+	cpu.runToScanline(midScreenScanline)
+	if cpu.framebuffer != nil {
+		cpu.drawScanlines(cpu.framebuffer, 0, midScreenScanline)
+	}
+	cpu.executeInterrupt(1)
 
-		for totalCycles < firstInterruptCycles {
-			cycles := cpu.executeInstruction()
-			totalCycles += cycles
-		}
+	cpu.runToScanline(vblankScanline)
+	if cpu.framebuffer != nil {
+		cpu.drawScanlines(cpu.framebuffer, midScreenScanline, vblankScanline)
+	}
+	cpu.executeInterrupt(2)
 
-		cpu.executeInterrupt(1)
+	cpu.runToScanline(scanlinesPerFrame)
+	cpu.frames++
+	cpu.tickWatchdog()
+}
 
-		for totalCycles < secondInterruptCycles {
-			cycles := cpu.executeInstruction()
-			totalCycles += cycles
-		}
+//cpu cycle at which the beam reaches a scanline, counted from power on. A frame is 33333 1/3
+//cycles, working from power on keeps the fractions and any overshoot of the last instruction
+//from adding up to drift
+func scanlineCycle(scanline uint64) uint64 {
+	return scanline * cpuClockHz / (frameRate * scanlinesPerFrame)
+}
 
-		cpu.executeInterrupt(2)
+func (cpu *cpu) runToScanline(scanline uint64) {
+	target := scanlineCycle(cpu.frames * scanlinesPerFrame + scanline)
+	for cpu.videoCycles < target && !cpu.halted {
+		cpu.executeInstruction()
+	}
+	cpu.videoCycles = max(cpu.videoCycles, target) //a halted cpu idles until the interrupt
+}
 
-		//update the pixel data directly
-		cpu.updateScreenBuffer(pixelData)
+//runs Space Invaders without a window or raylib, playing the -input script or else the determinism
+//checker's scripted game. Frames picked with -png/-pngevery and -gif are captured, the sound goes to wavPath
+func (cpu *cpu) runHeadless(frames int) {
+	cpu.setupSpaceInvaders()
 
-		//update the texture with the new pixel data
-		rl.UpdateTexture(screenTexture, pixelData)
+	inputs := []frameInput{}
+	if inputPath != "" {
+		var err error
+		if inputs, err = readInputScript(inputPath, frames); err != nil {
+			fmt.Println("Could not read inputs:", err)
+			cpu.exit(1)
+		}
+	} else {
+		inputs = determinismInputs(frames, determinismSeed)
+	}
 
-		rl.DrawTextureEx(screenTexture, rl.NewVector2(0, 0), 0, scale, rl.White)
+	if wavPath != "" {
+		cpu.sound = newWavRecorder(loadSounds(), wavPath)
+	}
+	pixelData := make([]color.RGBA, frameWidth * frameHeight)
+	cpu.framebuffer = pixelData
+	capture := &capture{}
 
-		if debug || fps {
-			rl.DrawFPS(0, 0)
+	for _, input := range inputs {
+		cpu.setInputs(input)
+		cpu.runFrame()
+		if cpu.sound != nil {
+			cpu.sound.update(cpu.cycles)
+		}
+		if cpu.profile != nil {
+			cpu.profile.frames++
 		}
 
-		rl.EndDrawing()
+		if err := capture.frame(int(cpu.frames), pixelData); err != nil {
+			fmt.Println("Could not capture frame:", err)
+			cpu.exit(1)
+		}
+	}
+	if err := capture.close(); err != nil {
+		fmt.Println("Could not capture frame:", err)
 	}
-}
\ No newline at end of file
+	if cpu.sound != nil {
+		cpu.sound.close()
+	}
+}
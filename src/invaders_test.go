@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden frames in testdata/golden")
+
+const goldenDir = "testdata/golden"
+
+//port 1 bits held down from frame from up to (not including) frame to
+type goldenInput struct {
+	from, to int
+	bits uint8
+}
+
+type goldenRun struct {
+	name string
+	inputs []goldenInput
+	checkpoints []int //frames that are compared against testdata/golden/<name>_<frame>.png
+}
+
+var goldenRuns = []goldenRun{
+	{"attract", nil, []int{60, 300, 900, 1500}},
+	{"play", []goldenInput{
+		{100, 104, 0x01}, //coin
+		{160, 164, 0x04}, //1P start
+		{400, 460, 0x20}, //left
+		{420, 424, 0x10}, //fire
+		{500, 560, 0x40}, //right
+		{540, 544, 0x10}, //fire
+	}, []int{200, 450, 600}},
+}
+
+func imageHash(img image.Image) string {
+	hash := sha256.New()
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			hash.Write([]byte{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)})
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))[:16]
+}
+
+func writeTestPNG(t *testing.T, filePath string, img image.Image) {
+	if err := writePNG(filePath, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//golden | actual | differences in red
+func diffImage(golden image.Image, actual image.Image) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, frameWidth * 3, frameHeight))
+	for y := 0; y < frameHeight; y++ {
+		for x := 0; x < frameWidth; x++ {
+			g := golden.At(x, y)
+			a := actual.At(x, y)
+			img.Set(x, y, g)
+			img.Set(x + frameWidth, y, a)
+			gr, gg, gb, _ := g.RGBA()
+			ar, ag, ab, _ := a.RGBA()
+			if gr != ar || gg != ag || gb != ab {
+				img.Set(x + frameWidth * 2, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x + frameWidth * 2, y, color.RGBA{0, 0, 0, 255})
+			}
+		}
+	}
+	return img
+}
+
+func compareGolden(t *testing.T, name string, actual *image.RGBA) {
+	goldenPath := filepath.Join(goldenDir, name + ".png")
+	if *updateGolden {
+		writeTestPNG(t, goldenPath, actual)
+		return
+	}
+
+	file, err := os.Open(goldenPath)
+	if err != nil {
+		t.Fatalf("missing golden frame %v, run go test -run Golden -update to create it", goldenPath)
+	}
+	golden, err := png.Decode(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goldenHash, actualHash := imageHash(golden), imageHash(actual)
+	if goldenHash == actualHash {
+		return
+	}
+	diffDir := filepath.Join(os.TempDir(), "go8080-golden")
+	os.MkdirAll(diffDir, 0755)
+	diffPath := filepath.Join(diffDir, name + "_diff.png")
+	writeTestPNG(t, diffPath, diffImage(golden, actual))
+	t.Errorf("frame %v changed: hash %v, golden %v, side by side diff (golden | actual | diff) in %v", name, actualHash, goldenHash, diffPath)
+}
+
+func TestGoldenFrames(t *testing.T) {
+	if *updateGolden {
+		os.MkdirAll(goldenDir, 0755)
+	}
+
+	for _, run := range goldenRuns {
+		t.Run(run.name, func(t *testing.T) {
+			cpu := cpu{}
+			cpu.cpuInit()
+			cpu.loadSpaceInvaders("../roms/invaders/invaders.rom")
+			pixelData := make([]color.RGBA, frameWidth * frameHeight)
+			cpu.framebuffer = pixelData
+
+			last := run.checkpoints[len(run.checkpoints) - 1]
+			next := 0
+			for frame := 1; frame <= last; frame++ {
+				cpu.port1 = 0
+				for _, input := range run.inputs {
+					if frame >= input.from && frame < input.to {
+						cpu.port1 |= input.bits
+					}
+				}
+
+				cpu.runFrame()
+
+				if frame == run.checkpoints[next] {
+					compareGolden(t, fmt.Sprintf("%v_%v", run.name, frame), frameImage(pixelData))
+					next++
+				}
+			}
+		})
+	}
+}
+
+//one Space Invaders frame: cpuClockHz / frameRate cycles (33333 1/3) run scanline by scanline, both
+//interrupts and the framebuffer conversion
+func BenchmarkFrame(b *testing.B) {
+	cpu := freshCpu(nil, nil)
+	cpu.loadSpaceInvaders("../roms/invaders/invaders.rom")
+	pixelData := make([]color.RGBA, frameWidth * frameHeight)
+	//get past the boot into the attract mode
+	for frame := 0; frame < 120; frame++ {
+		cpu.runFrame()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cpu.runFrame()
+		cpu.updateScreenBuffer(pixelData)
+	}
+	b.ReportMetric(float64(b.N) / b.Elapsed().Seconds(), "frames/s")
+}
+
+//the ROM reads the ships per game from the DIP switches when a game starts
+func TestDipSwitches(t *testing.T) {
+	if bits := dipSwitchBits(3, 1500, true); bits != 0x00 {
+		t.Fatalf("default DIP switches %02X, want 00", bits)
+	}
+	if bits := dipSwitchBits(6, 1000, false); bits != 0x8B {
+		t.Fatalf("6 ships, bonus at 1000, no coin info: %02X, want 8B", bits)
+	}
+
+	for _, ships := range []int{3, 4, 5, 6} {
+		cpu := freshCpu(nil, nil)
+		cpu.loadSpaceInvaders("../roms/invaders/invaders.rom")
+		cpu.dipSwitches = dipSwitchBits(ships, 1500, true)
+		for _, input := range determinismInputs(200, determinismSeed) {
+			cpu.setInputs(input)
+			cpu.runFrame()
+		}
+		//0x21FF counts the reserve ships, one is already on the field
+		if got := cpu.memory[0x21FF]; int(got) != ships - 1 {
+			t.Errorf("player 1 has %v reserve ships with the DIP switches set to %v ships", got, ships)
+		}
+	}
+}
+
+func TestCocktailCabinet(t *testing.T) {
+	cpu := freshCpu(nil, nil)
+	cpu.port1 = 0x10 //player 1 fires
+	cpu.port2 = 0x24 //player 2 moves left, tilt
+
+	cpu.portsIN(2)
+	if cpu.regs[regA] != 0x14 {
+		t.Fatalf("upright port 2 = %02X, want 14 (player 1 controls for both)", cpu.regs[regA])
+	}
+	cpu.cocktail = true
+	cpu.portsIN(2)
+	if cpu.regs[regA] != 0x24 {
+		t.Fatalf("cocktail port 2 = %02X, want 24 (player 2 controls only)", cpu.regs[regA])
+	}
+
+	//top left pixel of the unflipped screen is the last bit of the first column
+	cpu.memory[0x2400 + 31] = 0x80
+	pixelData := make([]color.RGBA, frameWidth * frameHeight)
+	white := color.RGBA{255, 255, 255, 255}
+	cpu.updateScreenBuffer(pixelData)
+	if pixelData[0] != white {
+		t.Fatal("unflipped screen: expected the top left pixel to be lit")
+	}
+
+	cpu.regs[regA] = 0x20
+	cpu.portsOUT(5)
+	cpu.updateScreenBuffer(pixelData)
+	if pixelData[len(pixelData) - 1] != white || pixelData[0] == white {
+		t.Fatal("flipped screen: expected the bottom right pixel to be lit instead")
+	}
+
+	cpu.cocktail = false
+	cpu.updateScreenBuffer(pixelData)
+	if pixelData[0] != white {
+		t.Fatal("an upright cabinet must ignore the flip bit")
+	}
+}
+
+func TestScanlineTiming(t *testing.T) {
+	//60 frames are exactly one second of cpu time, the interrupts land on their scanlines
+	if cycles := scanlineCycle(frameRate * scanlinesPerFrame); cycles != cpuClockHz {
+		t.Fatalf("60 frames take %v cycles, want %v", cycles, cpuClockHz)
+	}
+	if cycles := scanlineCycle(midScreenScanline); cycles != 12213 {
+		t.Fatalf("RST 1 at cycle %v, want 12213", cycles)
+	}
+
+	//RST 1 lights a byte at the start of scanline 0 and one on scanline 200: the beam has already
+	//passed scanline 0, so it only shows up in the next frame, scanline 200 shows straight away
+	cpu := freshCpu(nil, nil)
+	program := map[uint16][]uint8{
+		0x0000: {0x31, 0x00, 0x24, 0xFB, 0xC3, 0x04, 0x00}, //LXI SP,2400H; EI; JMP $
+		0x0008: {0x3E, 0x01, 0x32, 0x00, 0x24, 0x32, 0x00, 0x3D, 0xFB, 0xC9}, //MVI A,1; STA 2400H; STA 3D00H; EI; RET
+		0x0010: {0xFB, 0xC9}, //EI; RET
+	}
+	for addr, code := range program {
+		copy(cpu.memory[addr:], code)
+	}
+	cpu.framebuffer = make([]color.RGBA, frameWidth * frameHeight)
+	white := color.RGBA{255, 255, 255, 255}
+	bottomRow := (frameHeight - 1) * frameWidth
+
+	cpu.runFrame()
+	if cpu.framebuffer[bottomRow] == white || cpu.framebuffer[bottomRow + 200] != white {
+		t.Fatal("frame 1: expected only scanline 200 to be lit")
+	}
+	cpu.runFrame()
+	if cpu.framebuffer[bottomRow] != white {
+		t.Fatal("frame 2: expected scanline 0 to be lit")
+	}
+}
@@ -4,14 +4,55 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 //general settings
 var scale float32 = 2
 var debug bool = false
+var debugger bool = false
 var fps bool = false
+var stats bool = false
+var startTime time.Time
+var profilePath string = ""
+var coverageName string = ""
+var exerciserPath string = ""
+var testRomSpecs []string
+var scenarioPaths []string
+var determinismFrameCount int = determinismFrames
+var tracePaths [2]string
+var traceAlign string = "count"
+var traceColumns []string
+var traceContext int = traceContextDefault
+var samplesDir string = "roms/invaders/samples"
+var synth bool = false
+var mute bool = false
+var wavPath string = ""
+var headlessFrames int = determinismFrames
+
+//Space Invaders DIP switches
+var ships int = 3
+var bonusLife int = 1500
+var coinInfo bool = true
+var cabinet string = "upright"
+var watchdogTimeout int = watchdogTimeoutDefault
+var outputs bool = false
+var overlayName string = "none"
+var backdropPath string = ""
+var bezel int = 0
+var inputPath string = ""
+var recordPath string = ""
+var pngFrames []int
+var pngEvery int = 0
+var pngDir string = "frames"
+var gifPath string = ""
+var gifFirst int = 1
+var gifLast int = 0
+var captureScale int = 1
 
 func main() {
+	startTime = time.Now()
 	fmt.Println("GO-8080")
 	cpu := cpu{}
 	cpu.cpuInit()
@@ -25,21 +66,227 @@ func main() {
 			state = 1
 		} else if args[i] == "-c" {
 			state = 2
+		} else if args[i] == "-x" && i + 1 < len(args) {
+			state = 3
+			exerciserPath = args[i + 1]
+			i++
+		} else if args[i] == "test-rom" {
+			state = 4
+			for i + 1 < len(args) && !strings.HasPrefix(args[i + 1], "-") {
+				testRomSpecs = append(testRomSpecs, args[i + 1])
+				i++
+			}
+		} else if args[i] == "run" {
+			state = 5
+			for i + 1 < len(args) && !strings.HasPrefix(args[i + 1], "-") {
+				scenarioPaths = append(scenarioPaths, args[i + 1])
+				i++
+			}
+		} else if args[i] == "determinism" {
+			state = 6
+			if i + 1 < len(args) {
+				if frames, err := strconv.Atoi(args[i + 1]); err == nil {
+					determinismFrameCount = frames
+					i++
+				}
+			}
+		} else if args[i] == "tracediff" && i + 2 < len(args) {
+			state = 7
+			tracePaths = [2]string{args[i + 1], args[i + 2]}
+			i += 2
+		} else if args[i] == "-align" && i + 1 < len(args) {
+			traceAlign = args[i + 1]
+			i++
+		} else if args[i] == "-columns" && i + 1 < len(args) {
+			traceColumns = strings.Split(args[i + 1], ",")
+			i++
+		} else if args[i] == "-context" && i + 1 < len(args) {
+			var err error
+			if traceContext, err = strconv.Atoi(args[i + 1]); err != nil || traceContext < 0 {
+				usageError("-context <lines>, got " + args[i + 1])
+			}
+			i++
+		} else if args[i] == "-samples" && i + 1 < len(args) {
+			samplesDir = args[i + 1]
+			i++
+		} else if args[i] == "-synth" {
+			synth = true
+		} else if args[i] == "-mute" {
+			mute = true
+		} else if args[i] == "-wav" && i + 1 < len(args) {
+			state = 8
+			wavPath = args[i + 1]
+			i++
+		} else if args[i] == "-headless" {
+			state = 8
+		} else if args[i] == "-input" && i + 1 < len(args) {
+			inputPath = args[i + 1]
+			i++
+		} else if args[i] == "-record" && i + 1 < len(args) {
+			recordPath = args[i + 1]
+			i++
+		} else if args[i] == "-png" && i + 1 < len(args) {
+			for _, frame := range strings.Split(args[i + 1], ",") {
+				n, err := strconv.Atoi(strings.TrimSpace(frame))
+				if err != nil || n < 1 {
+					usageError("-png <n,n,...> with frames counting from 1, got " + args[i + 1])
+				}
+				pngFrames = append(pngFrames, n)
+			}
+			i++
+		} else if args[i] == "-pngevery" && i + 1 < len(args) {
+			var err error
+			if pngEvery, err = strconv.Atoi(args[i + 1]); err != nil || pngEvery < 1 {
+				usageError("-pngevery <frames>, got " + args[i + 1])
+			}
+			i++
+		} else if args[i] == "-pngdir" && i + 1 < len(args) {
+			pngDir = args[i + 1]
+			i++
+		} else if args[i] == "-gif" && i + 1 < len(args) {
+			gifPath = args[i + 1]
+			i++
+		} else if args[i] == "-gifspan" && i + 1 < len(args) {
+			var err error
+			if gifFirst, gifLast, err = parseFrameRange(args[i + 1]); err != nil {
+				usageError("-gifspan <first-last>, " + err.Error())
+			}
+			i++
+		} else if args[i] == "-capturescale" && i + 1 < len(args) {
+			var err error
+			if captureScale, err = strconv.Atoi(args[i + 1]); err != nil || captureScale < 1 {
+				usageError("-capturescale <n>, got " + args[i + 1])
+			}
+			i++
+		} else if args[i] == "-frames" && i + 1 < len(args) {
+			var err error
+			if headlessFrames, err = strconv.Atoi(args[i + 1]); err != nil || headlessFrames < 1 {
+				usageError("-frames <frames>, got " + args[i + 1])
+			}
+			i++
+		} else if args[i] == "-ships" && i + 1 < len(args) {
+			var err error
+			if ships, err = strconv.Atoi(args[i + 1]); err != nil || ships < 3 || ships > 6 {
+				usageError("-ships <3-6>, got " + args[i + 1])
+			}
+			i++
+		} else if args[i] == "-bonus" && i + 1 < len(args) {
+			var err error
+			if bonusLife, err = strconv.Atoi(args[i + 1]); err != nil || bonusLife != 1000 && bonusLife != 1500 {
+				usageError("-bonus <1000|1500>, got " + args[i + 1])
+			}
+			i++
+		} else if args[i] == "-coininfo" && i + 1 < len(args) {
+			if args[i + 1] != "on" && args[i + 1] != "off" {
+				usageError("-coininfo <on|off>, got " + args[i + 1])
+			}
+			coinInfo = args[i + 1] == "on"
+			i++
+		} else if args[i] == "-cabinet" && i + 1 < len(args) {
+			cabinet = args[i + 1]
+			if cabinet != "upright" && cabinet != "cocktail" {
+				usageError("-cabinet <upright|cocktail>, got " + cabinet)
+			}
+			i++
+		} else if args[i] == "-watchdog" && i + 1 < len(args) {
+			var err error
+			if watchdogTimeout, err = strconv.Atoi(args[i + 1]); err != nil || watchdogTimeout < 0 {
+				usageError("-watchdog <frames>, 0 turns it off, got " + args[i + 1])
+			}
+			i++
+		} else if args[i] == "-overlay" && i + 1 < len(args) {
+			overlayName = args[i + 1]
+			i++
+		} else if args[i] == "-backdrop" && i + 1 < len(args) {
+			backdropPath = args[i + 1]
+			i++
+		} else if args[i] == "-bezel" && i + 1 < len(args) {
+			var err error
+			if bezel, err = strconv.Atoi(args[i + 1]); err != nil || bezel < 0 {
+				usageError("-bezel <pixels>, got " + args[i + 1])
+			}
+			i++
+		} else if args[i] == "-outputs" {
+			outputs = true
 		} else if args[i] == "-d" {
 			debug = true
+		} else if args[i] == "-g" {
+			debugger = true
+		} else if args[i] == "-stats" {
+			stats = true
 		} else if args[i] == "-f" {
 			fps = true
+		} else if args[i] == "-profile" && i + 1 < len(args) {
+			profilePath = args[i + 1]
+			i++
+		} else if args[i] == "-coverage" && i + 1 < len(args) {
+			coverageName = args[i + 1]
+			i++
 		} else if args[i] == "-s" {
 			scale64, _ := strconv.ParseFloat(args[i + 1], 32)
 			scale = float32(scale64)
 		}
 	}
 
+	if profilePath != "" {
+		cpu.profile = newProfiler()
+	}
+	if coverageName != "" {
+		cpu.coverage = &coverage{}
+	}
+
 	if state == 1 {
 		cpu.runTST8080()
 	} else if state == 2 {
 		cpu.runCpudiag()
+	} else if state == 3 {
+		cpu.runExerciserCommand(exerciserPath)
+	} else if state == 4 {
+		cpu.runTestRomCommand(testRomSpecs)
+	} else if state == 5 {
+		cpu.runScenarioCommand(scenarioPaths, os.Stdout)
+	} else if state == 6 {
+		cpu.runDeterminismCommand(determinismFrameCount)
+	} else if state == 7 {
+		cpu.runTraceDiffCommand(tracePaths[0], tracePaths[1])
+	} else if state == 8 {
+		cpu.runHeadless(headlessFrames)
 	} else {
 		cpu.playSpaceInvaders()
 	}
+
+	cpu.exit(0)
+}
+
+//bad values are reported instead of quietly turning into defaults
+func usageError(usage string) {
+	fmt.Println("Usage:", usage)
+	os.Exit(2)
+}
+
+//writes any reports that were asked for on the command line, then exits
+func (cpu *cpu) exit(code int) {
+	if cpu.profile != nil {
+		cpu.profile.write(profilePath)
+	}
+	if cpu.coverage != nil {
+		cpu.writeCoverage(coverageName)
+	}
+	if stats {
+		cpu.printStats(time.Since(startTime))
+	}
+	os.Exit(code)
+}
+
+const cpuClockHz = 2000000 //the Space Invaders board runs its 8080 at about 2MHz
+
+func (cpu *cpu) printStats(elapsed time.Duration) {
+	seconds := elapsed.Seconds()
+	mhz := float64(cpu.cycles) / seconds / 1000000
+	fmt.Printf("%v instructions, %v cycles in %.2fs\n", cpu.instructions, cpu.cycles, seconds)
+	fmt.Printf("Emulated %.2f MHz (%.1fx a 2MHz 8080), %.2f million instructions/s\n", mhz, float64(cpu.cycles) / seconds / cpuClockHz, float64(cpu.instructions) / seconds / 1000000)
+	if cpu.frames > 0 {
+		fmt.Printf("%v frames, %.1f frames/s\n", cpu.frames, float64(cpu.frames) / seconds)
+		fmt.Printf("%v coin switch presses, %v watchdog resets\n", cpu.coinCount, cpu.watchdogResets)
+	}
 }
\ No newline at end of file
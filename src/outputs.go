@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+//the rest of the Space Invaders board's outputs: the watchdog on port 6 and a log of the cabinet
+//output bits on ports 3 and 5, plus a count of coin switch presses next to them
+
+//frames without a port 6 write before the watchdog resets the cpu, the game kicks it every
+//frame or so while drawing and leaves at most about 70 frames between kicks in the demo
+const watchdogTimeoutDefault = 255
+
+//names of the output bits, logged with -outputs when they change
+var port3OutNames = []string{"UFO", "shot", "player die", "invader die", "extra life", "amp"}
+var port5OutNames = []string{"fleet 1", "fleet 2", "fleet 3", "fleet 4", "UFO hit", "flip"}
+
+func (cpu *cpu) kickWatchdog() {
+	cpu.watchdogFrames = 0
+}
+
+//called once per frame, resets the cpu like the board does when the game hangs: the program
+//starts over from 0 with interrupts off, RAM keeps whatever was in it
+func (cpu *cpu) tickWatchdog() {
+	if watchdogTimeout <= 0 {
+		return
+	}
+	cpu.watchdogFrames++
+	if cpu.watchdogFrames <= watchdogTimeout {
+		return
+	}
+
+	fmt.Printf("Watchdog reset at PC %04X (frame %v), no port 6 write for %v frames\n", cpu.pc, cpu.frames, watchdogTimeout)
+	cpu.watchdogResets++
+	cpu.watchdogFrames = 0
+	cpu.pc = 0
+	cpu.interruptEnable = false
+	cpu.halted = false
+	cpu.callStack = cpu.callStack[:0]
+	cpu.regs[regA] = 0
+	cpu.portsOUT(3)
+	cpu.portsOUT(5)
+}
+
+//the game never drives a coin counter output, none of the port 3 or 5 bits it writes is one, so
+//there is no counter to show. What gets logged is the coin switch input, every press counts once
+func (cpu *cpu) countCoinSwitch() {
+	coin := cpu.port1 & 0x01 != 0
+	if coin && !cpu.coinSwitch {
+		cpu.coinCount++
+		cpu.logOutput("coin switch pressed, %v coins", cpu.coinCount)
+	}
+	cpu.coinSwitch = coin
+}
+
+func (cpu *cpu) logOutputBits(port uint8, previous uint8, value uint8) {
+	names := port3OutNames
+	if port == 5 {
+		names = port5OutNames
+	}
+	for bit, name := range names {
+		mask := uint8(1) << bit
+		if value & mask != previous & mask {
+			cpu.logOutput("%v %v", name, onOff(value & mask != 0))
+		}
+	}
+}
+
+func (cpu *cpu) logOutput(format string, args ...any) {
+	if outputs {
+		fmt.Printf("frame %6v: %v\n", cpu.frames, fmt.Sprintf(format, args...))
+	}
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+//one line per output latch for the -outputs panel, lit bits in upper case
+func (cpu *cpu) outputsPanel() []string {
+	bits := func(names []string, value uint8) string {
+		lit := []string{}
+		for bit, name := range names {
+			if value & (1 << bit) != 0 {
+				lit = append(lit, strings.ToUpper(name))
+			}
+		}
+		return strings.Join(lit, " ")
+	}
+	return []string{
+		fmt.Sprintf("COIN SWITCH %v  WATCHDOG %v/%v  RESETS %v", cpu.coinCount, cpu.watchdogFrames, watchdogTimeout, cpu.watchdogResets),
+		"P3 " + bits(port3OutNames, cpu.port3Out),
+		"P5 " + bits(port5OutNames, cpu.port5Out),
+	}
+}
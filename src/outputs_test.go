@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestWatchdog(t *testing.T) {
+	//counts boots in 0x2000, then hangs without kicking the watchdog
+	hang := []uint8{0x21, 0x00, 0x20, 0x34, 0xC3, 0x04, 0x00} //LXI H,2000H; INR M; JMP $
+	//kicks the watchdog forever
+	kick := []uint8{0x21, 0x00, 0x20, 0x34, 0xD3, 0x06, 0xC3, 0x04, 0x00} //LXI H,2000H; INR M; OUT 6; JMP $-2
+
+	for _, test := range []struct {
+		name string
+		program []uint8
+		boots uint8
+	}{{"hang", hang, 2}, {"kick", kick, 1}} {
+		cpu := freshCpu(nil, nil)
+		copy(cpu.memory[:], test.program)
+		//the reset comes at the end of the frame after the timeout, the program boots again in the next
+		for frame := 0; frame < watchdogTimeoutDefault + 2; frame++ {
+			cpu.runFrame()
+		}
+		if boots := cpu.memory[0x2000]; boots != test.boots {
+			t.Errorf("%v: booted %v times in %v frames, want %v", test.name, boots, watchdogTimeoutDefault + 2, test.boots)
+		}
+	}
+}
+
+//the game itself must never let the watchdog run out, in the demo or playing
+func TestWatchdogGame(t *testing.T) {
+	cpu := freshCpu(nil, nil)
+	cpu.loadSpaceInvaders("../roms/invaders/invaders.rom")
+	for _, input := range determinismInputs(3600, determinismSeed) {
+		cpu.setInputs(input)
+		cpu.runFrame()
+	}
+	if cpu.watchdogResets != 0 {
+		t.Fatalf("%v watchdog resets", cpu.watchdogResets)
+	}
+	if cpu.coinCount != 1 {
+		t.Fatalf("%v coin switch presses, want 1", cpu.coinCount)
+	}
+}
+
+func TestCoinSwitch(t *testing.T) {
+	cpu := freshCpu(nil, nil)
+	for _, coin := range []uint8{1, 1, 0, 1, 0, 0, 1, 1, 1} {
+		cpu.port1 = coin
+		cpu.countCoinSwitch()
+	}
+	if cpu.coinCount != 3 {
+		t.Fatalf("counted %v coins, want 3", cpu.coinCount)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+//the cabinet's monitor is black and white, the colour came from strips of cellophane on the glass.
+//An overlay is a list of bands, each "<rows> [<columns>] <colour>" in screen pixels with 0,0 at
+//the top left of the upright picture, e.g. "184-239 green" or "240-255 16-133 green". Colours are
+//names or RRGGBB hex, later bands cover earlier ones and lit pixels outside every band stay white
+
+var overlayProfiles = map[string][]string{
+	//the usual upright strips: red for the UFO, green over the shields, the player's ship and the
+	//reserve ships at the bottom left (the credits next to them stay white)
+	"midway": {
+		"32-63 red",
+		"184-239 green",
+		"240-255 16-133 green",
+	},
+}
+
+var overlayColors = map[string]color.RGBA{
+	"white": {255, 255, 255, 255},
+	"red": {255, 32, 32, 255},
+	"green": {32, 255, 32, 255},
+	"blue": {64, 128, 255, 255},
+	"yellow": {255, 255, 32, 255},
+	"cyan": {32, 255, 255, 255},
+	"magenta": {255, 64, 255, 255},
+	"orange": {255, 160, 32, 255},
+}
+
+//what an overlay file holds, YAML or JSON like the test ROM specs
+type overlaySpec struct {
+	Bands []string `json:"bands"`
+}
+
+//the colour of a lit pixel at every screen position, nil for plain black and white. name is
+//none, one of overlayProfiles, or the path of an overlay file
+func loadOverlay(name string) ([]color.RGBA, error) {
+	if name == "" || name == "none" {
+		return nil, nil
+	}
+	bands, ok := overlayProfiles[name]
+	if !ok {
+		spec := &overlaySpec{}
+		if err := readSpecFile(name, spec); err != nil {
+			return nil, err
+		}
+		bands = spec.Bands
+	}
+
+	pixels := make([]color.RGBA, frameWidth * frameHeight)
+	for i := range pixels {
+		pixels[i] = overlayColors["white"]
+	}
+	for _, band := range bands {
+		if err := paintOverlayBand(pixels, band); err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err)
+		}
+	}
+	return pixels, nil
+}
+
+func paintOverlayBand(pixels []color.RGBA, band string) error {
+	fields := strings.Fields(band)
+	if len(fields) != 2 && len(fields) != 3 {
+		return fmt.Errorf("expected <rows> [<columns>] <colour>, got %q", band)
+	}
+	top, bottom, err := overlayRange(fields[0], frameHeight)
+	if err != nil {
+		return fmt.Errorf("%v in %q", err, band)
+	}
+	left, right := 0, frameWidth - 1
+	if len(fields) == 3 {
+		if left, right, err = overlayRange(fields[1], frameWidth); err != nil {
+			return fmt.Errorf("%v in %q", err, band)
+		}
+	}
+	bandColor, err := overlayColor(fields[len(fields) - 1])
+	if err != nil {
+		return fmt.Errorf("%v in %q", err, band)
+	}
+
+	for y := top; y <= bottom; y++ {
+		for x := left; x <= right; x++ {
+			pixels[y * frameWidth + x] = bandColor
+		}
+	}
+	return nil
+}
+
+//"first-last" or a single number, inclusive and within 0..size-1
+func overlayRange(text string, size int) (int, int, error) {
+	firstText, lastText, found := strings.Cut(text, "-")
+	if !found {
+		lastText = firstText
+	}
+	first, err := strconv.Atoi(firstText)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad range %v", text)
+	}
+	last, err := strconv.Atoi(lastText)
+	if err != nil || first < 0 || last < first || last >= size {
+		return 0, 0, fmt.Errorf("bad range %v, must be within 0-%v", text, size - 1)
+	}
+	return first, last, nil
+}
+
+func overlayColor(text string) (color.RGBA, error) {
+	if named, ok := overlayColors[strings.ToLower(text)]; ok {
+		return named, nil
+	}
+	rgb, err := strconv.ParseUint(text, 16, 32)
+	if err != nil || len(text) != 6 {
+		return color.RGBA{}, fmt.Errorf("unknown colour %v, use a name or RRGGBB", text)
+	}
+	return color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 255}, nil
+}
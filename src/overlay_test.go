@@ -0,0 +1,57 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOverlayProfiles(t *testing.T) {
+	for name := range overlayProfiles {
+		pixels, err := loadOverlay(name)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		//the UFO row is red and the score at the top stays white in every profile
+		if pixels[40 * frameWidth + 100] != overlayColors["red"] || pixels[10 * frameWidth + 100] != overlayColors["white"] {
+			t.Errorf("%v: wrong colours for the UFO row and the score", name)
+		}
+	}
+	if pixels, err := loadOverlay("none"); pixels != nil || err != nil {
+		t.Fatal("none should be black and white")
+	}
+}
+
+func TestOverlayFile(t *testing.T) {
+	overlayPath := filepath.Join(t.TempDir(), "overlay.yaml")
+	os.WriteFile(overlayPath, []byte("bands:\n  - 0-255 blue   # everything\n  - 100 10-19 FF8000\n"), 0644)
+	pixels, err := loadOverlay(overlayPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pixels[100 * frameWidth + 10] != (color.RGBA{255, 128, 0, 255}) || pixels[100 * frameWidth + 20] != overlayColors["blue"] {
+		t.Fatal("bands painted in the wrong place")
+	}
+
+	for _, band := range []string{"10-300 red", "20-10 red", "10 purple", "red", "1 2 3 red"} {
+		os.WriteFile(overlayPath, []byte("bands: [" + band + "]\n"), 0644)
+		if _, err := loadOverlay(overlayPath); err == nil || !strings.Contains(err.Error(), "overlay.yaml") {
+			t.Errorf("%q: expected an error naming the file, got %v", band, err)
+		}
+	}
+}
+
+//the midway overlay over the attract mode invaders, shields and the UFO row
+func TestOverlayGolden(t *testing.T) {
+	cpu := freshCpu(nil, nil)
+	cpu.loadSpaceInvaders("../roms/invaders/invaders.rom")
+	cpu.overlay, _ = loadOverlay("midway")
+	pixelData := make([]color.RGBA, frameWidth * frameHeight)
+	cpu.framebuffer = pixelData
+	for frame := 0; frame < 900; frame++ {
+		cpu.runFrame()
+	}
+	compareGolden(t, "overlay_midway_900", frameImage(pixelData))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+const profileTop = 30
+
+//execution profile, enabled with -profile <file> and written when the program exits
+type profiler struct {
+	pcCount [65536]uint64
+	pcCycles [65536]uint64
+	opCount [256]uint64
+	opCycles [256]uint64
+	subroutines map[uint16]*subroutineStats
+	topLevelCycles uint64 //cycles spent outside of any call
+
+	instructions uint64
+	totalCycles uint64
+	frames uint64 //set by machines that run in frames (Space Invaders)
+
+	pc uint16 //pc and subroutine of the instruction being executed
+	sub *subroutineStats
+}
+
+type subroutineStats struct {
+	addr uint16
+	calls uint64
+	inclusive uint64 //cycles between the call and the return, including nested calls
+	self uint64 //cycles of instructions inside the subroutine itself
+}
+
+func newProfiler() *profiler {
+	return &profiler{subroutines: map[uint16]*subroutineStats{}}
+}
+
+func (p *profiler) subroutine(addr uint16) *subroutineStats {
+	sub, ok := p.subroutines[addr]
+	if !ok {
+		sub = &subroutineStats{addr: addr}
+		p.subroutines[addr] = sub
+	}
+	return sub
+}
+
+//called before an instruction runs
+func (p *profiler) begin(cpu *cpu) {
+	p.pc = cpu.pc
+	p.sub = nil
+	if len(cpu.callStack) > 0 {
+		p.sub = p.subroutine(cpu.callStack[len(cpu.callStack) - 1].target)
+	}
+}
+
+//called after an instruction ran
+func (p *profiler) end(opcode uint8, cycles int) {
+	p.instructions++
+	p.totalCycles += uint64(cycles)
+	p.pcCount[p.pc]++
+	p.pcCycles[p.pc] += uint64(cycles)
+	p.opCount[opcode]++
+	p.opCycles[opcode] += uint64(cycles)
+	if p.sub != nil {
+		p.sub.self += uint64(cycles)
+	} else {
+		p.topLevelCycles += uint64(cycles)
+	}
+}
+
+//called when a call frame is popped by a return
+func (p *profiler) leave(frame callFrame) {
+	sub := p.subroutine(frame.target)
+	sub.calls++
+	sub.inclusive += p.totalCycles - frame.startCycles
+}
+
+func (p *profiler) percent(cycles uint64) float64 {
+	if p.totalCycles == 0 {
+		return 0
+	}
+	return float64(cycles) * 100 / float64(p.totalCycles)
+}
+
+func (p *profiler) write(filePath string) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("Could not write profile:", err)
+		return
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "GO-8080 profile\n%v instructions, %v cycles\n", p.instructions, p.totalCycles)
+	if p.frames > 0 {
+		fmt.Fprintf(file, "%v frames, %.0f cycles per frame\n", p.frames, float64(p.totalCycles) / float64(p.frames))
+	}
+
+	pcs := []int{}
+	for pc := range p.pcCount {
+		if p.pcCount[pc] > 0 {
+			pcs = append(pcs, pc)
+		}
+	}
+	sort.Slice(pcs, func(i, j int) bool {
+		if p.pcCycles[pcs[i]] == p.pcCycles[pcs[j]] {
+			return pcs[i] < pcs[j]
+		}
+		return p.pcCycles[pcs[i]] > p.pcCycles[pcs[j]]
+	})
+	fmt.Fprintf(file, "\nHottest addresses\nPC    %12v %12v %7v\n", "count", "cycles", "%")
+	for i := 0; i < len(pcs) && i < profileTop; i++ {
+		pc := pcs[i]
+		fmt.Fprintf(file, "%04X  %12v %12v %6.2f%%\n", pc, p.pcCount[pc], p.pcCycles[pc], p.percent(p.pcCycles[pc]))
+	}
+
+	subs := []*subroutineStats{}
+	for _, sub := range p.subroutines {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].inclusive == subs[j].inclusive {
+			return subs[i].addr < subs[j].addr
+		}
+		return subs[i].inclusive > subs[j].inclusive
+	})
+	fmt.Fprintf(file, "\nHottest subroutines (inclusive cycles from CALL/RST/interrupt to RET)\nADDR  %10v %12v %7v %12v %7v", "calls", "inclusive", "%", "self", "%")
+	if p.frames > 0 {
+		fmt.Fprintf(file, " %12v", "incl/frame")
+	}
+	fmt.Fprintln(file)
+	for i := 0; i < len(subs) && i < profileTop; i++ {
+		sub := subs[i]
+		fmt.Fprintf(file, "%04X  %10v %12v %6.2f%% %12v %6.2f%%", sub.addr, sub.calls, sub.inclusive, p.percent(sub.inclusive), sub.self, p.percent(sub.self))
+		if p.frames > 0 {
+			fmt.Fprintf(file, " %12.0f", float64(sub.inclusive) / float64(p.frames))
+		}
+		fmt.Fprintln(file)
+	}
+	fmt.Fprintf(file, "(outside any call: %v cycles, %.2f%%)\n", p.topLevelCycles, p.percent(p.topLevelCycles))
+
+	ops := []int{}
+	for op := range p.opCount {
+		if p.opCount[op] > 0 {
+			ops = append(ops, op)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if p.opCount[ops[i]] == p.opCount[ops[j]] {
+			return ops[i] < ops[j]
+		}
+		return p.opCount[ops[i]] > p.opCount[ops[j]]
+	})
+	fmt.Fprintf(file, "\nOpcode histogram\nOP  %12v %12v %7v\n", "count", "cycles", "%")
+	for _, op := range ops {
+		fmt.Fprintf(file, "%02X  %12v %12v %6.2f%%\n", op, p.opCount[op], p.opCycles[op], p.percent(p.opCycles[op]))
+	}
+
+	fmt.Println("Profile written to:", filePath)
+}
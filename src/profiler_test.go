@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//a loop calling three subroutines, two of them the same length so their order comes from the tiebreak
+func TestProfileReport(t *testing.T) {
+	asm, err := assemble([]string{
+		"        LXI SP, 2400H",
+		"        MVI B, 3",
+		"loop:   CALL slow",
+		"        CALL second",
+		"        CALL first",
+		"        DCR B",
+		"        JNZ loop",
+		"        HLT",
+		"first:  NOP",
+		"        RET",
+		"second: NOP",
+		"        RET",
+		"slow:   NOP",
+		"        NOP",
+		"        NOP",
+		"        RET",
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := freshCpu(newProfiler(), nil)
+	copy(cpu.memory[:], asm.code)
+	for !cpu.halted {
+		cpu.executeInstruction()
+	}
+	profilePath := filepath.Join(t.TempDir(), "profile.txt")
+	cpu.profile.write(profilePath)
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(data)
+
+	tests := []struct {
+		section string
+		lines []string //the first lines of the section, in order
+	}{
+		//the three CALLs take 3 x 17 cycles each, ties go to the lower address
+		{"Hottest addresses", []string{
+			fmt.Sprintf("%04X  %12v %12v", asm.symbols["LOOP"], 3, 51),
+			fmt.Sprintf("%04X  %12v %12v", asm.symbols["LOOP"] + 3, 3, 51),
+			fmt.Sprintf("%04X  %12v %12v", asm.symbols["LOOP"] + 6, 3, 51),
+		}},
+		//inclusive cycles run from the CALL up to the RET: 17 for the CALL and 4 for every NOP
+		{"Hottest subroutines", []string{
+			fmt.Sprintf("%04X  %10v %12v", asm.symbols["SLOW"], 3, 3 * 29),
+			fmt.Sprintf("%04X  %10v %12v", asm.symbols["FIRST"], 3, 3 * 21),
+			fmt.Sprintf("%04X  %10v %12v", asm.symbols["SECOND"], 3, 3 * 21),
+		}},
+	}
+	for _, test := range tests {
+		_, section, found := strings.Cut(report, "\n" + test.section)
+		if !found {
+			t.Fatalf("no %v in the report:\n%v", test.section, report)
+		}
+		lines := strings.Split(section, "\n")[2:] //the rest of the title line and the column headings
+		for i, want := range test.lines {
+			if !strings.HasPrefix(lines[i], want) {
+				t.Errorf("%v line %v is %q, want it to start with %q", test.section, i + 1, lines[i], want)
+			}
+		}
+	}
+}
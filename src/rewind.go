@@ -0,0 +1,250 @@
+package main
+
+import "fmt"
+
+//reverse execution for the debugger: snapshots are taken every snapshotInterval steps, stepping
+//back restores the closest snapshot and re-executes forward, port reads and interrupts come from a log
+//so the replay takes the exact same path
+const snapshotInterval = 20000
+const snapshotMax = 100
+
+//everything needed to put the machine back to an earlier point
+type cpuState struct {
+	a, b, c, d, e, h, l uint8
+	pc, sp uint16
+	halted bool
+	zero, sign, parity, carry, ac bool
+	memory [65536]uint8
+	interruptEnable bool
+	shiftReg1, shiftReg2, shiftOffset uint8
+	port3Out, port5Out uint8
+	watchdogFrames int
+	videoCycles, frames uint64 //where the beam was, so replayed interrupts and frame ends line up with the real ones
+	callStack []callFrame
+	history [historySize]historyEntry //crash report history, replaying from here rebuilds it as it really was
+	historyPos, historyCount int
+}
+
+type snapshot struct {
+	timeline uint64
+	state cpuState
+}
+
+func (cpu *cpu) saveState(state *cpuState) {
+	state.a, state.b, state.c, state.d = cpu.regs[regA], cpu.regs[regB], cpu.regs[regC], cpu.regs[regD]
+	state.e, state.h, state.l = cpu.regs[regE], cpu.regs[regH], cpu.regs[regL]
+	state.pc, state.sp, state.halted = cpu.pc, cpu.sp, cpu.halted
+	state.zero, state.sign, state.parity, state.carry, state.ac = cpu.zero, cpu.sign, cpu.parity, cpu.carry, cpu.ac
+	state.memory = cpu.memory
+	state.interruptEnable = cpu.interruptEnable
+	state.shiftReg1, state.shiftReg2, state.shiftOffset = cpu.shiftReg1, cpu.shiftReg2, cpu.shiftOffset
+	state.port3Out, state.port5Out = cpu.port3Out, cpu.port5Out
+	state.watchdogFrames = cpu.watchdogFrames
+	state.videoCycles, state.frames = cpu.videoCycles, cpu.frames
+	state.callStack = append([]callFrame(nil), cpu.callStack...)
+	state.history, state.historyPos, state.historyCount = cpu.history, cpu.historyPos, cpu.historyCount
+}
+
+func (cpu *cpu) loadState(state *cpuState) {
+	cpu.regs[regA], cpu.regs[regB], cpu.regs[regC], cpu.regs[regD] = state.a, state.b, state.c, state.d
+	cpu.regs[regE], cpu.regs[regH], cpu.regs[regL] = state.e, state.h, state.l
+	cpu.pc, cpu.sp, cpu.halted = state.pc, state.sp, state.halted
+	cpu.zero, cpu.sign, cpu.parity, cpu.carry, cpu.ac = state.zero, state.sign, state.parity, state.carry, state.ac
+	cpu.memory = state.memory
+	cpu.interruptEnable = state.interruptEnable
+	cpu.shiftReg1, cpu.shiftReg2, cpu.shiftOffset = state.shiftReg1, state.shiftReg2, state.shiftOffset
+	cpu.port3Out, cpu.port5Out = state.port3Out, state.port5Out
+	cpu.watchdogFrames = state.watchdogFrames
+	cpu.videoCycles, cpu.frames = state.videoCycles, state.frames
+	cpu.callStack = append([]callFrame(nil), state.callStack...)
+	cpu.history, cpu.historyPos, cpu.historyCount = state.history, state.historyPos, state.historyCount
+}
+
+//true while re-running steps that already happened, the logs drive port reads and interrupts
+func (cpu *cpu) behindPresent() bool {
+	return cpu.timeline < cpu.timelineEnd
+}
+
+//called before every instruction when the debugger is on
+func (cpu *cpu) rewindHook() {
+	cpu.replayFrameEnds()
+
+	//interrupts that were taken at this point in the recorded timeline
+	for cpu.behindPresent() {
+		interruptNumber, ok := cpu.interruptLog[cpu.timeline]
+		if !ok {
+			break
+		}
+		cpu.interrupt(interruptNumber)
+	}
+
+	if cpu.behindPresent() {
+		return
+	}
+	if len(cpu.snapshots) == 0 || cpu.timeline - cpu.snapshots[len(cpu.snapshots) - 1].timeline >= snapshotInterval {
+		snap := &snapshot{timeline: cpu.timeline}
+		cpu.saveState(&snap.state)
+		cpu.snapshots = append(cpu.snapshots, snap)
+		if len(cpu.snapshots) > snapshotMax {
+			cpu.snapshots = cpu.snapshots[1:]
+			cpu.pruneRewindLogs(cpu.snapshots[0].timeline)
+		}
+	}
+}
+
+//runFrame ends a frame when the beam reaches the bottom, re-executed steps have to do it themselves.
+//Running normally the frame has already ended by the next step, so this does nothing
+func (cpu *cpu) replayFrameEnds() {
+	for cpu.followsBeam && cpu.videoCycles >= scanlineCycle((cpu.frames + 1) * scanlinesPerFrame) {
+		cpu.frames++
+		cpu.tickWatchdog()
+	}
+}
+
+//counts one step (instruction or interrupt) on the timeline
+func (cpu *cpu) advanceTimeline() {
+	cpu.timeline++
+	if cpu.timeline > cpu.timelineEnd {
+		cpu.timelineEnd = cpu.timeline
+	}
+}
+
+func (cpu *cpu) recordInput() {
+	if cpu.inputLog == nil {
+		cpu.inputLog = map[uint64]uint8{}
+	}
+	cpu.inputLog[cpu.timeline] = cpu.regs[regA]
+}
+
+func (cpu *cpu) recordInterrupt(interruptNumber uint8) {
+	if cpu.interruptLog == nil {
+		cpu.interruptLog = map[uint64]uint8{}
+	}
+	cpu.interruptLog[cpu.timeline] = interruptNumber
+}
+
+func (cpu *cpu) pruneRewindLogs(oldest uint64) {
+	for t := range cpu.inputLog {
+		if t < oldest {
+			delete(cpu.inputLog, t)
+		}
+	}
+	for t := range cpu.interruptLog {
+		if t < oldest {
+			delete(cpu.interruptLog, t)
+		}
+	}
+}
+
+//restores snapshot i and re-executes up to (not including) step end, visit is called before every instruction
+func (cpu *cpu) replayFrom(i int, end uint64, visit func()) {
+	cpu.loadState(&cpu.snapshots[i].state)
+	cpu.timeline = cpu.snapshots[i].timeline
+
+	cpu.replaying = true
+	for cpu.timeline < end {
+		cpu.replayFrameEnds()
+		if interruptNumber, ok := cpu.interruptLog[cpu.timeline]; ok {
+			cpu.interrupt(interruptNumber)
+			continue
+		}
+		if visit != nil {
+			visit()
+		}
+		cpu.executeInstruction()
+	}
+	cpu.replaying = false
+}
+
+//latest snapshot at or before step t, -1 if t is older than the history we kept
+func (cpu *cpu) snapshotBefore(t uint64) int {
+	for i := len(cpu.snapshots) - 1; i >= 0; i-- {
+		if cpu.snapshots[i].timeline <= t {
+			return i
+		}
+	}
+	return -1
+}
+
+func (cpu *cpu) rewindTo(t uint64) bool {
+	i := cpu.snapshotBefore(t)
+	if i < 0 {
+		fmt.Println("No rewind history that far back")
+		return false
+	}
+	cpu.replayFrom(i, t, nil)
+	return true
+}
+
+func (cpu *cpu) stepBack(n int) {
+	t := cpu.timeline
+	for ; n > 0 && t > 0; n-- {
+		t--
+		//land on an instruction, not on an interrupt
+		for _, ok := cpu.interruptLog[t]; ok && t > 0; _, ok = cpu.interruptLog[t] {
+			t--
+		}
+	}
+	cpu.rewindTo(t)
+}
+
+//searches backwards snapshot by snapshot, scan replays one snapshot up to end and returns the last hit in it
+func (cpu *cpu) reverseSearch(scan func(i int, end uint64) (uint64, bool)) bool {
+	now := cpu.timeline
+	if now == 0 {
+		return false
+	}
+
+	end := now
+	for i := cpu.snapshotBefore(now - 1); i >= 0; i-- {
+		if found, hit := scan(i, end); hit {
+			cpu.rewindTo(found)
+			return true
+		}
+		end = cpu.snapshots[i].timeline
+	}
+
+	cpu.rewindTo(now)
+	return false
+}
+
+func (cpu *cpu) reverseContinue() {
+	hit := cpu.reverseSearch(func(i int, end uint64) (uint64, bool) {
+		var found uint64
+		hit := false
+		cpu.replayFrom(i, end, func() {
+			if breakpoints[cpu.pc] {
+				found, hit = cpu.timeline, true
+			}
+		})
+		return found, hit
+	})
+	if !hit {
+		fmt.Println("No breakpoint hit in the rewind history")
+		return
+	}
+	fmt.Printf("Breakpoint at %04X\n", cpu.pc)
+}
+
+//rewinds to the last instruction that changed the byte at addr
+func (cpu *cpu) reverseToWrite(addr uint16) {
+	hit := cpu.reverseSearch(func(i int, end uint64) (uint64, bool) {
+		var found, prev uint64
+		var last uint8
+		hit, started := false, false
+		check := func() {
+			if started && cpu.memory[addr] != last {
+				found, hit = prev, true
+			}
+			last, prev, started = cpu.memory[addr], cpu.timeline, true
+		}
+		cpu.replayFrom(i, end, check)
+		check()
+		return found, hit
+	})
+	if !hit {
+		fmt.Printf("No write to %04X in the rewind history\n", addr)
+		return
+	}
+	fmt.Printf("%04X changed by the instruction at %04X\n", addr, cpu.pc)
+}
@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+//after stepping back, the crash report history holds the instructions that really came before,
+//the same as a machine that ran straight to that point
+func TestRewindHistory(t *testing.T) {
+	defer func(oldDebugger bool, oldSteps int) { debugger, stepsLeft = oldDebugger, oldSteps }(debugger, stepsLeft)
+	debugger, stepsLeft = true, -1
+
+	//counts B up and C down so every instruction leaves different registers behind
+	program := []uint8{0x04, 0x0D, 0x3C, 0xC3, 0x00, 0x00} //INR B; DCR C; INR A; JMP 0
+	rewound := freshCpu(nil, nil)
+	copy(rewound.memory[:], program)
+	for step := 0; step < snapshotInterval + 500; step++ {
+		rewound.executeInstruction()
+	}
+	rewound.stepBack(300)
+
+	debugger = false
+	straight := freshCpu(nil, nil)
+	copy(straight.memory[:], program)
+	for step := 0; step < snapshotInterval + 200; step++ {
+		straight.executeInstruction()
+	}
+
+	if rewound.historyCount != straight.historyCount {
+		t.Fatalf("%v history entries, want %v", rewound.historyCount, straight.historyCount)
+	}
+	for i := 1; i <= straight.historyCount; i++ {
+		got := rewound.history[(rewound.historyPos - i + historySize) % historySize]
+		want := straight.history[(straight.historyPos - i + historySize) % historySize]
+		if got != want {
+			t.Fatalf("history entry %v back is %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+//stepping back over an interrupt in the middle of an Invaders frame puts the beam back too, so the
+//replay takes its interrupts at the same instructions and ends up where a straight run does
+func TestRewindInterrupt(t *testing.T) {
+	defer func(oldDebugger bool, oldSteps int) { debugger, stepsLeft = oldDebugger, oldSteps }(debugger, stepsLeft)
+	const frames = 12
+
+	debugger = false
+	straight := freshCpu(nil, nil)
+	straight.loadSpaceInvaders("../roms/invaders/invaders.rom")
+	for frame := 0; frame < frames + 2; frame++ {
+		straight.runFrame()
+	}
+
+	debugger, stepsLeft = true, -1
+	rewound := freshCpu(nil, nil)
+	rewound.loadSpaceInvaders("../roms/invaders/invaders.rom")
+	for frame := 0; frame < frames; frame++ {
+		rewound.runFrame()
+	}
+	var lastInterrupt uint64
+	for step := range rewound.interruptLog {
+		lastInterrupt = max(lastInterrupt, step)
+	}
+	rewound.stepBack(int(rewound.timeline - lastInterrupt) + 100)
+	if rewound.timeline >= lastInterrupt || rewound.frames != frames - 1 {
+		t.Fatalf("stepped back to step %v in frame %v, want before step %v in frame %v", rewound.timeline, rewound.frames, lastInterrupt, frames - 1)
+	}
+	for frame := 0; frame < 3; frame++ {
+		rewound.runFrame()
+	}
+
+	if diff := diffState(&rewound, &straight); diff != "" || rewound.frames != straight.frames {
+		t.Fatalf("after the rewind: %v, frame %v vs %v", diff, rewound.frames, straight.frames)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const scenarioMaxCycles = 1000000 //default budget for programs that never reach HLT
+
+//a program plus the cpu state expected once it halts, run with run <scenario>..., for example:
+//
+//	name: add two numbers
+//	source:                  # or asm: file.asm, or binary: file.bin
+//	  - MVI A, 5
+//	  - ADI 2
+//	  - STA 2000H
+//	  - HLT
+//	setup: [B = 0x10]
+//	expect:
+//	  - A = 7
+//	  - CY = 0
+//	  - mem[0x2000] = 7
+type scenario struct {
+	Name string `json:"name"`
+	Binary string `json:"binary"`
+	Asm string `json:"asm"`
+	Source []string `json:"source"`
+	Load specNumber `json:"load"`
+	Entry *specNumber `json:"entry"`
+	MaxCycles specNumber `json:"max_cycles"`
+	Setup []string `json:"setup"`
+	Expect []string `json:"expect"`
+
+	symbols map[string]uint16 //labels of an assembled program, usable in setup and expect
+}
+
+func loadScenario(scenarioPath string) (*scenario, error) {
+	s := &scenario{}
+	if err := readSpecFile(scenarioPath, s); err != nil {
+		return nil, err
+	}
+	if s.Name == "" {
+		s.Name = filepath.Base(scenarioPath)
+	}
+	dir := filepath.Dir(scenarioPath)
+	if s.Binary != "" && !filepath.IsAbs(s.Binary) {
+		s.Binary = filepath.Join(dir, s.Binary)
+	}
+	if s.Asm != "" {
+		if !filepath.IsAbs(s.Asm) {
+			s.Asm = filepath.Join(dir, s.Asm)
+		}
+		data, err := os.ReadFile(s.Asm)
+		if err != nil {
+			return nil, err
+		}
+		s.Source = strings.Split(string(data), "\n")
+	}
+	if s.Binary == "" && len(s.Source) == 0 {
+		return nil, fmt.Errorf("%v: needs binary, asm or source", scenarioPath)
+	}
+	return s, nil
+}
+
+//puts the program in memory, applies the setup and runs until HLT or the cycle budget,
+//returns the differences from the expected state, empty when the scenario passed
+func (cpu *cpu) runScenario(s *scenario) ([]string, error) {
+	cpu.pc = uint16(s.Load)
+	if s.Binary != "" {
+		if err := cpu.readRom(s.Binary, int(s.Load)); err != nil {
+			return nil, err
+		}
+	} else {
+		asm, err := assemble(s.Source, uint16(s.Load))
+		if err != nil {
+			return nil, err
+		}
+		copy(cpu.memory[asm.origin:], asm.code)
+		cpu.pc = asm.origin
+		s.symbols = asm.symbols
+	}
+	if s.Entry != nil {
+		cpu.pc = uint16(*s.Entry)
+	}
+
+	for _, assignment := range s.Setup {
+		name, value, err := s.parseAssignment(assignment)
+		if err != nil {
+			return nil, err
+		}
+		if err := cpu.setScenarioValue(name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	maxCycles := uint64(s.MaxCycles)
+	if maxCycles == 0 {
+		maxCycles = scenarioMaxCycles
+	}
+	var cycles uint64
+	for !cpu.halted && cycles < maxCycles {
+		cycles += uint64(cpu.executeInstruction())
+	}
+
+	diffs := []string{}
+	if !cpu.halted {
+		diffs = append(diffs, fmt.Sprintf("did not reach HLT within %v cycles, stopped at PC %04X", maxCycles, cpu.pc))
+	}
+	for _, assignment := range s.Expect {
+		name, want, err := s.parseAssignment(assignment)
+		if err != nil {
+			return nil, err
+		}
+		got, width, err := cpu.scenarioValue(name)
+		if err != nil {
+			return nil, err
+		}
+		if got != want {
+			diffs = append(diffs, fmt.Sprintf("%v: got %0*X, want %0*X", name, width, got, width, want))
+		}
+	}
+	return diffs, nil
+}
+
+//"NAME = value", values and memory addresses are assembler expressions so they can use the program's labels
+func (s *scenario) parseAssignment(assignment string) (string, uint16, error) {
+	name, text, found := strings.Cut(assignment, "=")
+	if !found {
+		return "", 0, fmt.Errorf("expected NAME = value, got %q", assignment)
+	}
+	name = strings.ToUpper(strings.TrimSpace(name))
+	labels := &assembly{symbols: s.symbols}
+	if strings.HasPrefix(name, "MEM[") && strings.HasSuffix(name, "]") {
+		addr, err := labels.eval(name[4:len(name) - 1], 0, true)
+		if err != nil {
+			return "", 0, fmt.Errorf("%v in %q", err, assignment)
+		}
+		name = fmt.Sprintf("MEM[%04X]", addr)
+	}
+	value, err := labels.eval(strings.TrimSpace(text), 0, true)
+	if err != nil {
+		return "", 0, fmt.Errorf("%v in %q", err, assignment)
+	}
+	return name, value, nil
+}
+
+var scenarioRegs = map[string]int{"A": regA, "B": regB, "C": regC, "D": regD, "E": regE, "H": regH, "L": regL}
+
+var scenarioFlags = map[string]func(cpu *cpu) *bool{
+	"Z": func(cpu *cpu) *bool { return &cpu.zero },
+	"S": func(cpu *cpu) *bool { return &cpu.sign },
+	"P": func(cpu *cpu) *bool { return &cpu.parity },
+	"CY": func(cpu *cpu) *bool { return &cpu.carry },
+	"AC": func(cpu *cpu) *bool { return &cpu.ac },
+}
+
+//MEM[addr] as written by parseAssignment
+func scenarioMemoryAddress(name string) (uint16, bool) {
+	if !strings.HasPrefix(name, "MEM[") || !strings.HasSuffix(name, "]") {
+		return 0, false
+	}
+	addr, err := strconv.ParseUint(name[4:len(name) - 1], 16, 16)
+	return uint16(addr), err == nil
+}
+
+//current value of a register, pair, flag or memory byte and its width in hex digits
+func (cpu *cpu) scenarioValue(name string) (uint16, int, error) {
+	if reg, ok := scenarioRegs[name]; ok {
+		return uint16(cpu.regs[reg]), 2, nil
+	}
+	if flag, ok := scenarioFlags[name]; ok {
+		return uint16(flagBit(*flag(cpu))), 1, nil
+	}
+	if addr, ok := scenarioMemoryAddress(name); ok {
+		return uint16(cpu.memory[addr]), 2, nil
+	}
+	switch name {
+	case "BC", "DE", "HL":
+		return cpu.get16BitReg(strings.ToLower(name)), 4, nil
+	case "SP":
+		return cpu.sp, 4, nil
+	case "PC":
+		return cpu.pc, 4, nil
+	case "F":
+		return uint16(cpu.flagsByte()), 2, nil
+	}
+	return 0, 0, fmt.Errorf("unknown register, flag or memory %v", name)
+}
+
+func (cpu *cpu) setScenarioValue(name string, value uint16) error {
+	if reg, ok := scenarioRegs[name]; ok {
+		cpu.regs[reg] = uint8(value)
+		return nil
+	}
+	if flag, ok := scenarioFlags[name]; ok {
+		*flag(cpu) = value != 0
+		return nil
+	}
+	if addr, ok := scenarioMemoryAddress(name); ok {
+		cpu.memory[addr] = uint8(value)
+		return nil
+	}
+	switch name {
+	case "BC", "DE", "HL":
+		cpu.load16BitReg(strings.ToLower(name), value)
+	case "SP":
+		cpu.sp = value
+	case "PC":
+		cpu.pc = value
+	case "F":
+		cpu.setFlagsByte(uint8(value))
+	default:
+		return fmt.Errorf("unknown register, flag or memory %v", name)
+	}
+	return nil
+}
+
+//run command, prints a diff for every scenario that does not end in the expected state
+func (cpu *cpu) runScenarioCommand(scenarioPaths []string, out io.Writer) {
+	failed := 0
+	for _, scenarioPath := range scenarioPaths {
+		s, err := loadScenario(scenarioPath)
+		if err != nil {
+			fmt.Fprintln(out, "FAIL ", err)
+			failed++
+			continue
+		}
+
+		*cpu = freshCpu(cpu.profile, cpu.coverage)
+		diffs, err := cpu.runScenario(s)
+		if err != nil {
+			fmt.Fprintf(out, "FAIL  %v: %v\n", s.Name, err)
+			failed++
+		} else if len(diffs) > 0 {
+			fmt.Fprintf(out, "FAIL  %v\n", s.Name)
+			for _, diff := range diffs {
+				fmt.Fprintf(out, "    %v\n", diff)
+			}
+			cpu.printRegisters(out)
+			failed++
+		} else {
+			fmt.Fprintf(out, "PASS  %v\n", s.Name)
+		}
+	}
+
+	fmt.Fprintf(out, "%v/%v scenarios passed\n", len(scenarioPaths) - failed, len(scenarioPaths))
+	if failed > 0 {
+		cpu.exit(1)
+	}
+	cpu.exit(0)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScenarios(t *testing.T) {
+	files, _ := filepath.Glob("../roms/scenarios/*.yaml")
+	if len(files) == 0 {
+		t.Fatal("no scenarios in ../roms/scenarios")
+	}
+	for _, file := range files {
+		s, err := loadScenario(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpu := freshCpu(nil, nil)
+		diffs, err := cpu.runScenario(s)
+		if err != nil {
+			t.Fatalf("%v: %v", s.Name, err)
+		}
+		if len(diffs) > 0 {
+			t.Errorf("%v:\n%v", s.Name, strings.Join(diffs, "\n"))
+		}
+	}
+}
+
+func TestScenarioDiff(t *testing.T) {
+	s := &scenario{
+		Source: []string{"MVI A, 1", "loop: JMP loop"},
+		MaxCycles: 100,
+		Setup: []string{"mem[0x2000] = 5"},
+		Expect: []string{"A = 2", "mem[0x2000] = 5", "PC = loop"},
+	}
+	cpu := freshCpu(nil, nil)
+	diffs, err := cpu.runScenario(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || !strings.HasPrefix(diffs[0], "did not reach HLT") || diffs[1] != "A: got 01, want 02" {
+		t.Fatalf("diffs %q", diffs)
+	}
+}
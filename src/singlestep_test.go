@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//runs the per-opcode JSON test files from the SingleStepTests 8080 suite, they are not part of the
+//repository, put them in roms/singlestep (or point GO8080_SINGLESTEP at them) to run this
+const singleStepMaxReports = 10 //failing cases reported per file
+
+type singleStepState struct {
+	PC *uint16 `json:"pc"`
+	SP *uint16 `json:"sp"`
+	A *uint8 `json:"a"`
+	B *uint8 `json:"b"`
+	C *uint8 `json:"c"`
+	D *uint8 `json:"d"`
+	E *uint8 `json:"e"`
+	F *uint8 `json:"f"`
+	H *uint8 `json:"h"`
+	L *uint8 `json:"l"`
+	RAM [][2]int `json:"ram"`
+}
+
+type singleStepCase struct {
+	Name string `json:"name"`
+	Initial singleStepState `json:"initial"`
+	Final singleStepState `json:"final"`
+	Cycles []json.RawMessage `json:"cycles"` //one entry per clock cycle
+}
+
+//opcodes that leave the CPU core: IN/OUT go to the Space Invaders ports
+var singleStepSkip = map[uint8]string{
+	0xDB: "IN reads the Space Invaders ports",
+	0xD3: "OUT writes the Space Invaders ports",
+}
+
+func (state *singleStepState) load(cpu *cpu) {
+	set8 := func(dst *uint8, src *uint8) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	set8(&cpu.regs[regA], state.A)
+	set8(&cpu.regs[regB], state.B)
+	set8(&cpu.regs[regC], state.C)
+	set8(&cpu.regs[regD], state.D)
+	set8(&cpu.regs[regE], state.E)
+	set8(&cpu.regs[regH], state.H)
+	set8(&cpu.regs[regL], state.L)
+	if state.F != nil {
+		cpu.setFlagsByte(*state.F)
+	}
+	if state.PC != nil {
+		cpu.pc = *state.PC
+	}
+	if state.SP != nil {
+		cpu.sp = *state.SP
+	}
+	for _, ram := range state.RAM {
+		cpu.memory[uint16(ram[0])] = uint8(ram[1])
+	}
+}
+
+//field-level differences between the cpu and the expected state
+func (state *singleStepState) diff(cpu *cpu) []string {
+	diffs := []string{}
+	check8 := func(name string, got uint8, want *uint8) {
+		if want != nil && got != *want {
+			diffs = append(diffs, fmt.Sprintf("%v: got %02X, want %02X", name, got, *want))
+		}
+	}
+	check8("A", cpu.regs[regA], state.A)
+	check8("B", cpu.regs[regB], state.B)
+	check8("C", cpu.regs[regC], state.C)
+	check8("D", cpu.regs[regD], state.D)
+	check8("E", cpu.regs[regE], state.E)
+	check8("H", cpu.regs[regH], state.H)
+	check8("L", cpu.regs[regL], state.L)
+	if state.F != nil && cpu.flagsByte() != *state.F {
+		diffs = append(diffs, fmt.Sprintf("F: got %08b, want %08b (SZ-A-P-C)", cpu.flagsByte(), *state.F))
+	}
+	if state.PC != nil && cpu.pc != *state.PC {
+		diffs = append(diffs, fmt.Sprintf("PC: got %04X, want %04X", cpu.pc, *state.PC))
+	}
+	if state.SP != nil && cpu.sp != *state.SP {
+		diffs = append(diffs, fmt.Sprintf("SP: got %04X, want %04X", cpu.sp, *state.SP))
+	}
+	for _, ram := range state.RAM {
+		addr := uint16(ram[0])
+		if cpu.memory[addr] != uint8(ram[1]) {
+			diffs = append(diffs, fmt.Sprintf("RAM[%04X]: got %02X, want %02X", addr, cpu.memory[addr], ram[1]))
+		}
+	}
+	return diffs
+}
+
+func runSingleStepCase(c *singleStepCase) []string {
+	cpu := cpu{}
+	cpu.cpuInit()
+	c.Initial.load(&cpu)
+
+	cycles := cpu.executeInstruction()
+
+	diffs := c.Final.diff(&cpu)
+	if len(c.Cycles) > 0 && cycles != len(c.Cycles) {
+		diffs = append(diffs, fmt.Sprintf("cycles: got %v, want %v", cycles, len(c.Cycles)))
+	}
+	return diffs
+}
+
+func TestSingleStep(t *testing.T) {
+	dir := os.Getenv("GO8080_SINGLESTEP")
+	if dir == "" {
+		dir = "../roms/singlestep"
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) == 0 {
+		t.Skip("no SingleStepTests JSON files in", dir)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cases []singleStepCase
+			if err := json.Unmarshal(data, &cases); err != nil {
+				t.Fatalf("could not parse %v: %v", file, err)
+			}
+
+			failed := 0
+			for i := range cases {
+				c := &cases[i]
+				probe := cpu{}
+				c.Initial.load(&probe)
+				if reason, skip := singleStepSkip[probe.memory[probe.pc]]; skip {
+					t.Skip(reason)
+				}
+
+				diffs := runSingleStepCase(c)
+				if len(diffs) == 0 {
+					continue
+				}
+				failed++
+				if failed <= singleStepMaxReports {
+					t.Errorf("%v:", c.Name)
+					for _, diff := range diffs {
+						t.Errorf("    %v", diff)
+					}
+				}
+			}
+			if failed > 0 {
+				t.Errorf("%v of %v cases failed", failed, len(cases))
+			}
+		})
+	}
+}
+
+//checks the runner itself on a hand written ADD B case
+func TestSingleStepRunner(t *testing.T) {
+	data := `{"name": "80 0001",
+		"initial": {"pc": 256, "sp": 0, "a": 58, "b": 198, "c": 0, "d": 0, "e": 0, "f": 2, "h": 0, "l": 0, "ram": [[256, 128]]},
+		"final": {"pc": 257, "sp": 0, "a": 0, "b": 198, "c": 0, "d": 0, "e": 0, "f": 87, "h": 0, "l": 0, "ram": [[256, 128]]},
+		"cycles": [[256, 128, "r"], [256, 128, "r"], [256, 128, "r"], [256, 128, "r"]]}`
+	var c singleStepCase
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		t.Fatal(err)
+	}
+	if diffs := runSingleStepCase(&c); len(diffs) > 0 {
+		t.Fatalf("ADD B: %v", diffs)
+	}
+
+	*c.Final.A = 1
+	if diffs := runSingleStepCase(&c); len(diffs) != 1 {
+		t.Fatalf("expected one diff for a wrong A, got %v", diffs)
+	}
+}
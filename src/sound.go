@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+//Space Invaders sound: writes to ports 3 and 5 switch the cabinet's sound circuits on and off,
+//a sound starts on the rising edge of its bit and the UFO sound repeats while its bit stays set
+
+const soundSampleRate = 44100
+
+//sound numbers, also the names of the sample files (0.wav...9.wav)
+const (
+	soundUFO = iota //port 3 bit 0, loops
+	soundShot //port 3 bit 1
+	soundPlayerDie //port 3 bit 2
+	soundInvaderDie //port 3 bit 3
+	soundFleet1 //port 5 bits 0-3, the four notes of the fleet march
+	soundFleet2
+	soundFleet3
+	soundFleet4
+	soundUFOHit //port 5 bit 4
+	soundExtraLife //port 3 bit 4
+	soundCount
+)
+
+var port3Sounds = []int{soundUFO, soundShot, soundPlayerDie, soundInvaderDie, soundExtraLife}
+var port5Sounds = []int{soundFleet1, soundFleet2, soundFleet3, soundFleet4, soundUFOHit}
+
+const soundAmpEnable = 0x20 //port 3 bit 5, the game turns the amplifier off in attract mode
+
+//one mono sample per sound at soundSampleRate, nil for sounds that have none
+type soundBank [soundCount][]float32
+
+//somewhere for sound events to go, cycles is cpu.cycles when the event happened
+type soundPlayer interface {
+	start(sound int, cycles uint64)
+	stop(sound int, cycles uint64)
+	update(cycles uint64) //called once per frame
+	close()
+}
+
+func (cpu *cpu) soundOut(port uint8, value uint8) {
+	sounds, previous := port3Sounds, cpu.port3Out
+	if port == 5 {
+		sounds, previous = port5Sounds, cpu.port5Out
+		cpu.port5Out = value
+	} else {
+		cpu.port3Out = value
+	}
+	if cpu.sound == nil || cpu.replaying {
+		return
+	}
+
+	amp := cpu.port3Out & soundAmpEnable != 0
+	for bit, sound := range sounds {
+		mask := uint8(1) << bit
+		if value & mask != 0 && previous & mask == 0 && amp {
+			cpu.sound.start(sound, cpu.cycles)
+		}
+		if sound == soundUFO && previous & mask != 0 && (value & mask == 0 || !amp) {
+			cpu.sound.stop(sound, cpu.cycles)
+		}
+	}
+}
+
+//0.wav...9.wav from dir, missing or empty files leave that sound silent
+func loadSoundSamples(dir string) (*soundBank, int) {
+	bank := &soundBank{}
+	loaded := 0
+	for sound := range bank {
+		samples, err := readWav(filepath.Join(dir, fmt.Sprintf("%v.wav", sound)))
+		if err != nil || len(samples) == 0 {
+			continue
+		}
+		bank[sound] = samples
+		loaded++
+	}
+	return bank, loaded
+}
+
+//mixes every sound into one track and writes it as a WAV file on close, for running without a sound card
+type wavRecorder struct {
+	bank *soundBank
+	filePath string
+	voices []soundVoice
+	end uint64 //cycles at the last update
+}
+
+type soundVoice struct {
+	sound int
+	start, stop int //in samples, stop is -1 while a looping sound is still on
+}
+
+func cyclesToSamples(cycles uint64) int {
+	return int(cycles * soundSampleRate / cpuClockHz)
+}
+
+func newWavRecorder(bank *soundBank, filePath string) *wavRecorder {
+	return &wavRecorder{bank: bank, filePath: filePath}
+}
+
+func (recorder *wavRecorder) start(sound int, cycles uint64) {
+	if recorder.bank[sound] == nil {
+		return
+	}
+	stop := cyclesToSamples(cycles) + len(recorder.bank[sound])
+	if sound == soundUFO {
+		stop = -1
+	}
+	recorder.voices = append(recorder.voices, soundVoice{sound, cyclesToSamples(cycles), stop})
+}
+
+func (recorder *wavRecorder) stop(sound int, cycles uint64) {
+	for i := range recorder.voices {
+		if recorder.voices[i].sound == sound && recorder.voices[i].stop < 0 {
+			recorder.voices[i].stop = cyclesToSamples(cycles)
+		}
+	}
+}
+
+func (recorder *wavRecorder) update(cycles uint64) {
+	recorder.end = cycles
+}
+
+func (recorder *wavRecorder) mix() []float32 {
+	track := make([]float32, cyclesToSamples(recorder.end))
+	for _, voice := range recorder.voices {
+		samples := recorder.bank[voice.sound]
+		if len(samples) == 0 {
+			continue
+		}
+		stop := voice.stop
+		if stop < 0 || stop > len(track) {
+			stop = len(track)
+		}
+		for t := voice.start; t < stop; t++ {
+			track[t] += samples[(t - voice.start) % len(samples)] * 0.5
+		}
+	}
+	return track
+}
+
+func (recorder *wavRecorder) close() {
+	if err := writeWav(recorder.filePath, recorder.mix()); err != nil {
+		fmt.Println("Could not write sound:", err)
+		return
+	}
+	fmt.Println("Sound written to:", recorder.filePath)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//records sound events instead of playing them
+type soundLog struct {
+	started, stopped [soundCount]int
+}
+
+func (log *soundLog) start(sound int, cycles uint64) { log.started[sound]++ }
+func (log *soundLog) stop(sound int, cycles uint64) { log.stopped[sound]++ }
+func (log *soundLog) update(cycles uint64) {}
+func (log *soundLog) close() {}
+
+func TestSoundEdges(t *testing.T) {
+	log := &soundLog{}
+	cpu := freshCpu(nil, nil)
+	cpu.sound = log
+
+	cpu.soundOut(3, 0x02) //shot with the amplifier off
+	cpu.soundOut(3, 0x00)
+	if log.started[soundShot] != 0 {
+		t.Fatal("a sound played with the amplifier off")
+	}
+
+	cpu.soundOut(3, soundAmpEnable | 0x03) //UFO and shot
+	cpu.soundOut(3, soundAmpEnable | 0x03) //held, no new edge
+	cpu.soundOut(3, soundAmpEnable | 0x01) //shot released, UFO still on
+	cpu.soundOut(5, 0x01) //fleet note 1
+	cpu.soundOut(5, 0x02) //fleet note 2
+	cpu.soundOut(3, soundAmpEnable) //UFO off
+
+	if log.started[soundShot] != 1 || log.started[soundUFO] != 1 {
+		t.Fatalf("started %v, want one shot and one UFO", log.started)
+	}
+	if log.started[soundFleet1] != 1 || log.started[soundFleet2] != 1 {
+		t.Fatalf("fleet notes started %v", log.started)
+	}
+	if log.stopped[soundUFO] != 1 {
+		t.Fatalf("UFO stopped %v times, want 1", log.stopped[soundUFO])
+	}
+}
+
+//a scripted game must make the shot, fleet march and invader death sounds
+func TestGameSounds(t *testing.T) {
+	log := &soundLog{}
+	cpu := freshCpu(nil, nil)
+	cpu.loadSpaceInvaders("../roms/invaders/invaders.rom")
+	cpu.sound = log
+	for _, input := range determinismInputs(1800, determinismSeed) {
+		cpu.setInputs(input)
+		cpu.runFrame()
+	}
+	for _, sound := range []int{soundShot, soundFleet1, soundFleet4, soundInvaderDie} {
+		if log.started[sound] == 0 {
+			t.Errorf("sound %v never started, started %v", sound, log.started)
+		}
+	}
+}
+
+func TestWavRoundTrip(t *testing.T) {
+	samples := []float32{0, 0.5, -0.5, 1, -1}
+	filePath := filepath.Join(t.TempDir(), "0.wav")
+	if err := writeWav(filePath, samples); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readWav(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(samples) {
+		t.Fatalf("read %v samples, want %v", len(read), len(samples))
+	}
+	for i := range samples {
+		if diff := read[i] - samples[i]; diff > 0.001 || diff < -0.001 {
+			t.Fatalf("sample %v = %v, want %v", i, read[i], samples[i])
+		}
+	}
+
+	//an empty sample counts as missing so the synthesizer fills in for it
+	emptyPath := filepath.Join(filepath.Dir(filePath), "1.wav")
+	writeWav(emptyPath, []float32{})
+	bank, loaded := loadSoundSamples(filepath.Dir(filePath))
+	if loaded != 1 || len(bank[soundUFO]) != len(samples) || bank[1] != nil {
+		t.Fatalf("loaded %v samples from the directory", loaded)
+	}
+	os.Remove(filePath)
+	os.Remove(emptyPath)
+}
+
+func TestWavRecorder(t *testing.T) {
+	bank := &soundBank{}
+	bank[soundShot] = []float32{1, 1}
+	bank[soundUFO] = []float32{0.5}
+	recorder := newWavRecorder(bank, "")
+	recorder.start(soundShot, 0)
+	recorder.start(soundUFO, 0)
+	recorder.stop(soundUFO, uint64(cpuClockHz) / soundSampleRate * 4) //after 4 samples
+	recorder.update(cpuClockHz / 1000) //1ms, 44 samples
+
+	track := recorder.mix()
+	if len(track) != 44 {
+		t.Fatalf("track has %v samples, want 44", len(track))
+	}
+	if track[0] != 0.75 || track[2] != 0.25 || track[10] != 0 {
+		t.Fatalf("mixed track starts %v", track[:12])
+	}
+
+	bank[soundUFO] = []float32{}
+	recorder = newWavRecorder(bank, "")
+	recorder.start(soundUFO, 0)
+	recorder.update(cpuClockHz / 1000)
+	if track := recorder.mix(); track[0] != 0 {
+		t.Fatalf("an empty sample mixed in as %v", track[0])
+	}
+}
+
+func TestSynthesizedSounds(t *testing.T) {
+	bank := synthesizeSounds()
+	for sound, samples := range bank {
+		if len(samples) == 0 {
+			t.Errorf("sound %v is empty", sound)
+			continue
+		}
+		peak := float32(0)
+		for _, sample := range samples {
+			peak = max(peak, sample, -sample)
+		}
+		if peak > 1 || peak < 0.05 {
+			t.Errorf("sound %v peaks at %v", sound, peak)
+		}
+	}
+	if len(bank[soundUFO]) != soundSampleRate / 6 {
+		t.Errorf("UFO loop is %v samples, want one sweep", len(bank[soundUFO]))
+	}
+	if again := synthesizeSounds(); again[soundPlayerDie][1000] != bank[soundPlayerDie][1000] {
+		t.Error("synthesized noise is not repeatable")
+	}
+}
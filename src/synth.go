@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+//rough software versions of the cabinet's sound circuits (discrete analog parts plus an SN76477
+//for the UFO), used for every sound there is no sample file for
+
+func synthSamples(seconds float64) []float32 {
+	return make([]float32, int(seconds * soundSampleRate))
+}
+
+//white noise from a 17-bit shift register like the SN76477 noise generator
+type synthNoise struct {
+	lfsr uint32
+}
+
+func (noise *synthNoise) next() float32 {
+	if noise.lfsr == 0 {
+		noise.lfsr = 1
+	}
+	bit := (noise.lfsr ^ noise.lfsr >> 3) & 1
+	noise.lfsr = noise.lfsr >> 1 | bit << 16
+	return float32(noise.lfsr & 1) * 2 - 1
+}
+
+//one pole low pass, cutoff in Hz
+type synthLowPass struct {
+	value float32
+}
+
+func (filter *synthLowPass) next(input float32, cutoff float64) float32 {
+	alpha := float32(1 - math.Exp(-2 * math.Pi * cutoff / soundSampleRate))
+	filter.value += (input - filter.value) * alpha
+	return filter.value
+}
+
+func synthSquare(phase float64) float32 {
+	if phase - math.Floor(phase) < 0.5 {
+		return 1
+	}
+	return -1
+}
+
+func synthTriangle(phase float64) float64 {
+	phase -= math.Floor(phase)
+	return 1 - math.Abs(phase * 2 - 1)
+}
+
+//a low square wave thump, the fleet march is four of these stepping down
+func synthFleetNote(frequency float64) []float32 {
+	samples := synthSamples(0.12)
+	filter := synthLowPass{}
+	for i := range samples {
+		t := float64(i) / soundSampleRate
+		samples[i] = filter.next(synthSquare(t * frequency), 400) * float32(math.Exp(-t * 18)) * 0.9
+	}
+	return samples
+}
+
+//a tone swept up and down by a slow triangle, exactly one sweep long so it loops cleanly
+func synthUFO() []float32 {
+	const sweepHz = 6
+	samples := synthSamples(1.0 / sweepHz)
+	phase := 0.0
+	for i := range samples {
+		t := float64(i) / soundSampleRate
+		phase += (450 + 650 * synthTriangle(t * sweepHz)) / soundSampleRate
+		samples[i] = float32(synthTriangle(phase) * 2 - 1) * 0.35
+	}
+	return samples
+}
+
+//falling tone with some noise on top
+func synthShot() []float32 {
+	samples := synthSamples(0.35)
+	noise := synthNoise{}
+	phase := 0.0
+	for i := range samples {
+		t := float64(i) / soundSampleRate
+		phase += 1800 * math.Exp(-t * 6) / soundSampleRate
+		samples[i] = (synthSquare(phase) * 0.7 + noise.next() * 0.3) * float32(math.Exp(-t * 7)) * 0.5
+	}
+	return samples
+}
+
+//filtered noise, the filter closing and the volume falling as it goes, rumble sets the wobble rate
+func synthExplosion(seconds float64, cutoff float64, rumble float64) []float32 {
+	samples := synthSamples(seconds)
+	noise := synthNoise{lfsr: 0x1ACE1}
+	filter := synthLowPass{}
+	for i := range samples {
+		t := float64(i) / soundSampleRate
+		left := 1 - t / seconds
+		wobble := 1.0
+		if rumble > 0 {
+			wobble = 0.6 + 0.4 * synthTriangle(t * rumble)
+		}
+		samples[i] = filter.next(noise.next(), cutoff * (0.3 + 0.7 * left)) * float32(left * left * wobble) * 0.5
+	}
+	return samples
+}
+
+//fast warble between two pitches, fading out
+func synthUFOHit() []float32 {
+	samples := synthSamples(1.0)
+	phase := 0.0
+	for i := range samples {
+		t := float64(i) / soundSampleRate
+		frequency := 300.0
+		if synthSquare(t * 16) > 0 {
+			frequency = 900
+		}
+		phase += frequency / soundSampleRate
+		samples[i] = synthSquare(phase) * float32(1 - t) * 0.35
+	}
+	return samples
+}
+
+//a beeping tone
+func synthExtraLife() []float32 {
+	samples := synthSamples(1.0)
+	for i := range samples {
+		t := float64(i) / soundSampleRate
+		if synthSquare(t * 5) < 0 {
+			continue
+		}
+		samples[i] = float32(math.Sin(2 * math.Pi * 1300 * t)) * 0.35
+	}
+	return samples
+}
+
+func synthesizeSounds() *soundBank {
+	bank := &soundBank{}
+	bank[soundUFO] = synthUFO()
+	bank[soundShot] = synthShot()
+	bank[soundPlayerDie] = synthExplosion(1.2, 1500, 12)
+	bank[soundInvaderDie] = synthExplosion(0.3, 3000, 0)
+	bank[soundFleet1] = synthFleetNote(62)
+	bank[soundFleet2] = synthFleetNote(55)
+	bank[soundFleet3] = synthFleetNote(49)
+	bank[soundFleet4] = synthFleetNote(46)
+	bank[soundUFOHit] = synthUFOHit()
+	bank[soundExtraLife] = synthExtraLife()
+	return bank
+}
+
+//samples from samplesDir where there are any, synthesized sounds for the rest (all of them with -synth)
+func loadSounds() *soundBank {
+	bank, loaded := &soundBank{}, 0
+	if !synth {
+		bank, loaded = loadSoundSamples(samplesDir)
+	}
+	synthesized := synthesizeSounds()
+	for sound := range bank {
+		if bank[sound] == nil {
+			bank[sound] = synthesized[sound]
+		}
+	}
+
+	if loaded == 0 {
+		fmt.Println("Using synthesized sound")
+	} else if loaded < soundCount {
+		fmt.Printf("%v of %v sounds from %v, the rest synthesized\n", loaded, soundCount, samplesDir)
+	}
+	return bank
+}
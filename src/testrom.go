@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//declarative test ROMs, run with test-rom <spec>..., a spec is a JSON or YAML file like:
+//
+//	name: cpudiag
+//	rom: cpudiag.bin      # relative to the spec file
+//	load: 0x100
+//	entry: 0x100          # defaults to load
+//	success_pc: [0x069B]
+//	failure_pc: [0x0689]
+//	success_output: []    # strings printed through the BDOS traps
+//	failure_output: []
+//	max_cycles: 10000000
+//	bdos: false           # CP/M traps: BDOS calls at 0x0005, warm boot at 0x0000
+type romSpec struct {
+	Name string `json:"name"`
+	Rom string `json:"rom"`
+	Load specNumber `json:"load"`
+	Entry *specNumber `json:"entry"`
+	SuccessPC []specNumber `json:"success_pc"`
+	FailurePC []specNumber `json:"failure_pc"`
+	SuccessOutput []string `json:"success_output"`
+	FailureOutput []string `json:"failure_output"`
+	MaxCycles specNumber `json:"max_cycles"`
+	Bdos bool `json:"bdos"`
+}
+
+//numbers in a spec can be written as 1234, "1234" or "0x04D2"
+type specNumber uint64
+
+func (n *specNumber) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(text), 0, 64)
+	if err != nil {
+		return fmt.Errorf("not a number: %v", string(data))
+	}
+	*n = specNumber(value)
+	return nil
+}
+
+//decodes a .json file, or anything else as flat YAML, into v
+func readSpecFile(specPath string, v interface{}) error {
+	data, err := os.ReadFile(specPath)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(filepath.Ext(specPath), ".json") {
+		fields, err := parseSpecYAML(data)
+		if err != nil {
+			return fmt.Errorf("%v: %v", specPath, err)
+		}
+		data, _ = json.Marshal(fields)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%v: %v", specPath, err)
+	}
+	return nil
+}
+
+func loadRomSpec(specPath string) (*romSpec, error) {
+	spec := &romSpec{}
+	if err := readSpecFile(specPath, spec); err != nil {
+		return nil, err
+	}
+	if spec.Rom == "" {
+		return nil, fmt.Errorf("%v: no rom given", specPath)
+	}
+	if !filepath.IsAbs(spec.Rom) {
+		spec.Rom = filepath.Join(filepath.Dir(specPath), spec.Rom)
+	}
+	if spec.Name == "" {
+		spec.Name = filepath.Base(spec.Rom)
+	}
+	if spec.Load > 0xFFFF || spec.Entry != nil && *spec.Entry > 0xFFFF {
+		return nil, fmt.Errorf("%v: load and entry must be within 0x0000-0xFFFF", specPath)
+	}
+	if info, err := os.Stat(spec.Rom); err != nil {
+		return nil, fmt.Errorf("%v: %v", specPath, err)
+	} else if uint64(spec.Load) + uint64(info.Size()) > 0x10000 {
+		return nil, fmt.Errorf("%v: %v bytes of rom do not fit in memory at %04X", specPath, info.Size(), uint64(spec.Load))
+	}
+	if len(spec.SuccessPC) == 0 && len(spec.SuccessOutput) == 0 {
+		return nil, fmt.Errorf("%v: needs success_pc or success_output", specPath)
+	}
+	return spec, nil
+}
+
+//the flat subset of YAML the specs need: "key: value", "key: [a, b]" and "key:" followed by "- item" lines
+func parseSpecYAML(data []byte) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	listKey := ""
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(stripSpecComment(line), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %v: list item without a key", n + 1)
+			}
+			fields[listKey] = append(fields[listKey].([]interface{}), specScalar(strings.TrimSpace(trimmed[1:])))
+			continue
+		}
+
+		key, value, found := strings.Cut(trimmed, ":")
+		if !found || line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %v: expected key: value", n + 1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		listKey = ""
+		if value == "" {
+			listKey = key
+			fields[key] = []interface{}{}
+		} else if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			items := []interface{}{}
+			for _, item := range strings.Split(value[1:len(value) - 1], ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, specScalar(item))
+				}
+			}
+			fields[key] = items
+		} else {
+			fields[key] = specScalar(value)
+		}
+	}
+	return fields, nil
+}
+
+func stripSpecComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch {
+		case quote != 0 && line[i] == quote:
+			quote = 0
+		case quote == 0 && (line[i] == '"' || line[i] == '\''):
+			quote = line[i]
+		case quote == 0 && line[i] == '#' && (i == 0 || line[i - 1] == ' ' || line[i - 1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func specScalar(value string) interface{} {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value) - 1] == value[0] {
+		return value[1:len(value) - 1]
+	}
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	return value //numbers stay strings, specNumber parses them
+}
+
+//runs one spec on a fresh machine, output from the BDOS traps also goes to out
+func (cpu *cpu) runTestRom(spec *romSpec, out io.Writer) (bool, string) {
+	if err := cpu.readRom(spec.Rom, int(spec.Load)); err != nil {
+		return false, err.Error()
+	}
+	cpu.pc = uint16(spec.Load)
+	if spec.Entry != nil {
+		cpu.pc = uint16(*spec.Entry)
+	}
+	if spec.Bdos {
+		cpu.memory[0x0000] = 0x76 //HLT
+		cpu.memory[0x0005] = 0xC9 //RET
+	}
+
+	var output bytes.Buffer
+	writer := io.MultiWriter(out, &output)
+	var cycles uint64
+	stopped := ""
+	for stopped == "" {
+		if containsPC(spec.SuccessPC, cpu.pc) {
+			return true, fmt.Sprintf("reached success address %04X after %v cycles", cpu.pc, cycles)
+		}
+		if containsPC(spec.FailurePC, cpu.pc) {
+			return false, fmt.Sprintf("reached failure address %04X after %v cycles", cpu.pc, cycles)
+		}
+
+		if spec.Bdos && cpu.pc == 0x0005 {
+			if cpu.regs[regC] == 0x00 {
+				stopped = "BDOS 0"
+				break
+			}
+			printed := output.Len()
+			cpu.cpmBdos(writer)
+			if output.Len() != printed {
+				if text, found := findOutput(output.String(), spec.FailureOutput); found {
+					return false, fmt.Sprintf("printed %q", text)
+				}
+			}
+		} else if spec.Bdos && cpu.pc == 0x0000 {
+			stopped = "warm boot"
+			break
+		}
+
+		if spec.MaxCycles > 0 && cycles >= uint64(spec.MaxCycles) {
+			return false, fmt.Sprintf("cycle limit of %v reached at PC %04X", uint64(spec.MaxCycles), cpu.pc)
+		}
+		cycles += uint64(cpu.executeInstruction())
+		if cpu.halted {
+			stopped = fmt.Sprintf("HLT at %04X", cpu.pc - 1)
+		}
+	}
+
+	if text, found := findOutput(output.String(), spec.FailureOutput); found {
+		return false, fmt.Sprintf("printed %q", text)
+	}
+	if text, found := findOutput(output.String(), spec.SuccessOutput); found {
+		return true, fmt.Sprintf("printed %q, stopped on %v after %v cycles", text, stopped, cycles)
+	}
+	return false, fmt.Sprintf("stopped on %v after %v cycles without a success condition", stopped, cycles)
+}
+
+func containsPC(addrs []specNumber, pc uint16) bool {
+	for _, addr := range addrs {
+		if uint16(addr) == pc {
+			return true
+		}
+	}
+	return false
+}
+
+func findOutput(output string, texts []string) (string, bool) {
+	for _, text := range texts {
+		if strings.Contains(output, text) {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+//a power-on machine that keeps the reports asked for on the command line
+func freshCpu(profile *profiler, coverage *coverage) cpu {
+	fresh := cpu{profile: profile, coverage: coverage}
+	fresh.cpuInit()
+	return fresh
+}
+
+//test-rom command, runs every spec and exits 0 only if all of them passed
+func (cpu *cpu) runTestRomCommand(specPaths []string) {
+	failed := 0
+	for _, specPath := range specPaths {
+		spec, err := loadRomSpec(specPath)
+		if err != nil {
+			fmt.Println("FAIL ", err)
+			failed++
+			continue
+		}
+
+		*cpu = freshCpu(cpu.profile, cpu.coverage)
+		passed, reason := cpu.runTestRom(spec, os.Stdout)
+		if passed {
+			fmt.Printf("\nPASS  %v: %v\n", spec.Name, reason)
+		} else {
+			fmt.Printf("\nFAIL  %v: %v\n", spec.Name, reason)
+			failed++
+		}
+	}
+
+	fmt.Printf("%v/%v test ROMs passed\n", len(specPaths) - failed, len(specPaths))
+	if failed > 0 {
+		cpu.exit(1)
+	}
+	cpu.exit(0)
+}
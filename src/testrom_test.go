@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//the spec files shipped next to the diagnostics must keep passing
+func TestRomSpecs(t *testing.T) {
+	for _, specPath := range []string{"../roms/cpudiag/cpudiag.yaml", "../roms/TST8080/TST8080.json"} {
+		spec, err := loadRomSpec(specPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpu := freshCpu(nil, nil)
+		if passed, reason := cpu.runTestRom(spec, io.Discard); !passed {
+			t.Errorf("%v failed: %v", spec.Name, reason)
+		}
+	}
+}
+
+//a bad spec or ROM fails the spec instead of crashing the harness
+func TestRomSpecErrors(t *testing.T) {
+	dir := t.TempDir()
+	romPath := filepath.Join(dir, "test.bin")
+	os.WriteFile(romPath, []byte{0x76, 0x76, 0x76, 0x76}, 0644)
+	specPath := filepath.Join(dir, "test.yaml")
+	for _, spec := range []string{
+		"rom: nothere.bin\nsuccess_pc: [0]\n",
+		"rom: test.bin\nload: 0x1FFFF\nsuccess_pc: [0]\n",
+		"rom: test.bin\nload: 0xFFFE\nsuccess_pc: [0]\n",
+		"rom: test.bin\nentry: 0x10000\nsuccess_pc: [0]\n",
+	} {
+		os.WriteFile(specPath, []byte(spec), 0644)
+		if _, err := loadRomSpec(specPath); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+
+	cpu := freshCpu(nil, nil)
+	if passed, reason := cpu.runTestRom(&romSpec{Rom: filepath.Join(dir, "gone.bin")}, io.Discard); passed || reason == "" {
+		t.Fatalf("missing rom: passed %v, reason %q", passed, reason)
+	}
+}
+
+func TestParseSpecYAML(t *testing.T) {
+	data := `# comment
+name: "demo # not a comment"
+load: 0x100
+success_pc: [0x0200, 512]
+failure_output:
+  - FAIL
+  - 'BAD: #1'
+bdos: true
+`
+	fields, err := parseSpecYAML([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["name"] != "demo # not a comment" || fields["load"] != "0x100" || fields["bdos"] != true {
+		t.Fatalf("scalars parsed as %v", fields)
+	}
+	if list := fields["success_pc"].([]interface{}); len(list) != 2 || list[1] != "512" {
+		t.Fatalf("inline list parsed as %v", list)
+	}
+	if list := fields["failure_output"].([]interface{}); len(list) != 2 || list[1] != "BAD: #1" {
+		t.Fatalf("block list parsed as %v", list)
+	}
+
+	if _, err := parseSpecYAML([]byte("- orphan\n")); err == nil {
+		t.Fatal("expected an error for a list item without a key")
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//tracediff compares a -d trace with a log from another emulator and reports the first instruction
+//where they disagree. The other log is either KEY:VALUE / KEY=VALUE tokens (PC: 0100, AF: 0002, ...)
+//or plain columns named with -columns (e.g. pc,op,a,f,b,c,d,e,h,l,sp), values are hex
+
+const traceContextDefault = 5
+
+type traceRecord struct {
+	line int
+	text string
+	values map[string]string //PC, SP, A...L, the flags Z, S, P, CY, AC and memory writes (WRITE)
+}
+
+//columns that may be in a reference log but are not compared
+var traceIgnoredColumns = map[string]bool{"-": true, "OP": true, "CYCLES": true, "CYC": true}
+
+func (record *traceRecord) set(name string, value string) {
+	name = strings.ToUpper(name)
+	if traceIgnoredColumns[name] {
+		return
+	}
+	if name == "WRITE" || name == "W" {
+		record.values["WRITE"] = strings.ToUpper(value)
+		return
+	}
+
+	value = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(value), "h"), "0x"), "$")
+	number, err := strconv.ParseUint(value, 16, 16)
+	if err != nil {
+		return
+	}
+	switch name {
+	case "AF", "PSW":
+		record.values["A"] = fmt.Sprintf("%02X", number >> 8)
+		record.setFlagByte(uint8(number))
+	case "BC", "DE", "HL":
+		record.values[name[:1]] = fmt.Sprintf("%02X", number >> 8)
+		record.values[name[1:]] = fmt.Sprintf("%02X", number & 0xFF)
+	case "F":
+		record.setFlagByte(uint8(number))
+	case "PC", "SP":
+		record.values[name] = fmt.Sprintf("%04X", number)
+	case "Z", "S", "P", "CY", "AC":
+		record.values[name] = fmt.Sprintf("%X", number & 1)
+	default:
+		record.values[name] = fmt.Sprintf("%02X", number)
+	}
+}
+
+//8080 flag byte: S Z 0 AC 0 P 1 CY
+func (record *traceRecord) setFlagByte(flags uint8) {
+	record.values["S"] = fmt.Sprintf("%X", flags >> 7 & 1)
+	record.values["Z"] = fmt.Sprintf("%X", flags >> 6 & 1)
+	record.values["AC"] = fmt.Sprintf("%X", flags >> 4 & 1)
+	record.values["P"] = fmt.Sprintf("%X", flags >> 2 & 1)
+	record.values["CY"] = fmt.Sprintf("%X", flags & 1)
+}
+
+//one trace line, ok is false for lines without a PC (banners, program output)
+func parseTraceLine(line string, columns []string) (traceRecord, bool) {
+	record := traceRecord{text: line, values: map[string]string{}}
+	tokens := strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' })
+
+	switch {
+	case len(columns) > 0:
+		for i, column := range columns {
+			if i < len(tokens) {
+				record.set(column, tokens[i])
+			}
+		}
+	case strings.HasPrefix(line, "A:") && strings.Contains(line, " BC:") && len(tokens) >= 11:
+		//our -d trace: A C(arry) P S Z BC DE HL SP, then PC and opcode without names
+		names := []string{"A", "CY", "P", "S", "Z", "BC", "DE", "HL", "SP"}
+		for i, name := range names {
+			_, value, _ := strings.Cut(tokens[i], ":")
+			record.set(name, value)
+		}
+		record.set("PC", tokens[9])
+	default:
+		for i := 0; i < len(tokens); i++ {
+			name, value, found := strings.Cut(tokens[i], ":")
+			if !found {
+				name, value, found = strings.Cut(tokens[i], "=")
+			}
+			if !found {
+				continue
+			}
+			if value == "" && i + 1 < len(tokens) {
+				//"PC: 0100"
+				i++
+				value = tokens[i]
+			}
+			record.set(name, value)
+		}
+	}
+
+	_, ok := record.values["PC"]
+	return record, ok
+}
+
+func readTrace(filePath string, columns []string) ([]traceRecord, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := []traceRecord{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64 * 1024), 1024 * 1024)
+	for n := 1; scanner.Scan(); n++ {
+		if record, ok := parseTraceLine(scanner.Text(), columns); ok {
+			record.line = n
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+//fields both records have that do not match, sorted by name
+func (record *traceRecord) diff(other *traceRecord) []string {
+	diffs := []string{}
+	for name, value := range record.values {
+		if otherValue, ok := other.values[name]; ok && otherValue != value {
+			diffs = append(diffs, fmt.Sprintf("%v: %v vs %v", name, value, otherValue))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+//index pairs to compare: by count both traces start at their first record, by pc the reference
+//starts at its first record with the same PC as our first record
+func alignTraces(ours []traceRecord, reference []traceRecord, align string) (int, int, error) {
+	if align != "count" && align != "pc" {
+		return 0, 0, fmt.Errorf("unknown alignment %v, use count or pc", align)
+	}
+	if align == "count" || len(ours) == 0 {
+		return 0, 0, nil
+	}
+	for j := range reference {
+		if reference[j].values["PC"] == ours[0].values["PC"] {
+			return 0, j, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("the reference never reaches PC %v", ours[0].values["PC"])
+}
+
+//returns true when the traces agree for as long as both run
+func traceDiff(ours []traceRecord, reference []traceRecord, align string, context int, out io.Writer) bool {
+	i, j, err := alignTraces(ours, reference, align)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return false
+	}
+
+	start := i
+	for ; i < len(ours) && j < len(reference); i, j = i + 1, j + 1 {
+		diffs := ours[i].diff(&reference[j])
+		if len(diffs) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(out, "First difference at instruction %v (our line %v, reference line %v)\n", i - start + 1, ours[i].line, reference[j].line)
+		for _, diff := range diffs {
+			fmt.Fprintf(out, "    %v\n", diff)
+		}
+		before := min(context, i - start)
+		fmt.Fprintln(out, "\nours:")
+		for k := i - before; k <= i; k++ {
+			fmt.Fprintf(out, "%v %6v  %v\n", traceMarker(k == i), ours[k].line, ours[k].text)
+		}
+		fmt.Fprintln(out, "reference:")
+		for k := j - before; k <= j; k++ {
+			fmt.Fprintf(out, "%v %6v  %v\n", traceMarker(k == j), reference[k].line, reference[k].text)
+		}
+		return false
+	}
+
+	fmt.Fprintf(out, "Traces match for %v instructions", i - start)
+	if i < len(ours) || j < len(reference) {
+		fmt.Fprintf(out, " (ours has %v more, the reference %v more)", len(ours) - i, len(reference) - j)
+	}
+	fmt.Fprintln(out)
+	return true
+}
+
+func traceMarker(current bool) string {
+	if current {
+		return ">"
+	}
+	return " "
+}
+
+func (cpu *cpu) runTraceDiffCommand(oursPath string, referencePath string) {
+	ours, err := readTrace(oursPath, nil)
+	if err != nil {
+		fmt.Println("Could not read trace:", err)
+		cpu.exit(1)
+	}
+	reference, err := readTrace(referencePath, traceColumns)
+	if err != nil {
+		fmt.Println("Could not read trace:", err)
+		cpu.exit(1)
+	}
+	fmt.Printf("%v: %v instructions, %v: %v instructions\n", oursPath, len(ours), referencePath, len(reference))
+
+	if traceDiff(ours, reference, traceAlign, traceContext, os.Stdout) {
+		cpu.exit(0)
+	}
+	cpu.exit(1)
+}
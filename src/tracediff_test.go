@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceLine(t *testing.T) {
+	ours, ok := parseTraceLine("A:3F C:1  P:0  S:0  Z:0  BC:12  DE:0    HL:2400 SP:23FE  1A5  C6   10        ADI 10", nil)
+	if !ok {
+		t.Fatal("our trace line was not recognised")
+	}
+	want := map[string]string{"A": "3F", "CY": "1", "P": "0", "S": "0", "Z": "0", "B": "00", "C": "12", "D": "00", "E": "00", "H": "24", "L": "00", "SP": "23FE", "PC": "01A5"}
+	for name, value := range want {
+		if ours.values[name] != value {
+			t.Errorf("ours %v = %q, want %q", name, ours.values[name], value)
+		}
+	}
+
+	//AF 3F03: S0 Z0 AC0 P0... flag byte 03 has CY set
+	named, ok := parseTraceLine("PC: 01A5, AF: 3F03, BC: 0012, DE: 0000, HL: 2400, SP: 23FE", nil)
+	if !ok || len(named.diff(&ours)) != 0 {
+		t.Fatalf("named columns differ from ours: %v", named.diff(&ours))
+	}
+
+	columns, ok := parseTraceLine("01a5 c6 3f 03 00 12 00 00 24 00 23fe", strings.Split("pc,op,a,f,b,c,d,e,h,l,sp", ","))
+	if !ok || len(columns.diff(&ours)) != 0 {
+		t.Fatalf("positional columns differ from ours: %v", columns.diff(&ours))
+	}
+
+	if _, ok := parseTraceLine("8192 bytes loaded into memory", nil); ok {
+		t.Fatal("a line without a PC was parsed as an instruction")
+	}
+}
+
+func TestTraceDiff(t *testing.T) {
+	parse := func(lines ...string) []traceRecord {
+		records := []traceRecord{}
+		for n, line := range lines {
+			record, _ := parseTraceLine(line, nil)
+			record.line = n + 1
+			records = append(records, record)
+		}
+		return records
+	}
+	ours := parse("PC=0100 A=00", "PC=0102 A=05", "PC=0104 A=07", "PC=0105 A=07")
+	reference := parse("PC=0000 A=00", "PC=0100 A=00", "PC=0102 A=05", "PC=0104 A=08")
+
+	var out bytes.Buffer
+	if traceDiff(ours, reference, "pc", 1, &out) {
+		t.Fatal("expected a difference")
+	}
+	if !strings.Contains(out.String(), "instruction 3 (our line 3, reference line 4)") || !strings.Contains(out.String(), "A: 07 vs 08") {
+		t.Fatalf("unexpected report:\n%v", out.String())
+	}
+
+	out.Reset()
+	if traceDiff(ours[:2], reference[1:3], "count", 1, &out) != true {
+		t.Fatalf("expected matching traces:\n%v", out.String())
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+//just enough of the WAV format for sound samples: 8 or 16-bit PCM in, 16-bit mono out
+
+//decodes a PCM WAV file to mono samples in -1..1 at soundSampleRate
+func readWav(filePath string) ([]float32, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("%v: not a WAV file", filePath)
+	}
+
+	var channels, bits int
+	var rate int
+	var pcm []byte
+	for pos := 12; pos + 8 <= len(data); {
+		id := string(data[pos:pos + 4])
+		size := int(binary.LittleEndian.Uint32(data[pos + 4:]))
+		body := data[pos + 8:min(pos + 8 + size, len(data))]
+		switch id {
+		case "fmt ":
+			if len(body) < 16 || binary.LittleEndian.Uint16(body[0:]) != 1 {
+				return nil, fmt.Errorf("%v: only PCM WAV files are supported", filePath)
+			}
+			channels = int(binary.LittleEndian.Uint16(body[2:]))
+			rate = int(binary.LittleEndian.Uint32(body[4:]))
+			bits = int(binary.LittleEndian.Uint16(body[14:]))
+		case "data":
+			pcm = body
+		}
+		pos += 8 + size + size % 2
+	}
+	if channels == 0 || rate == 0 || (bits != 8 && bits != 16) {
+		return nil, fmt.Errorf("%v: only 8 and 16-bit PCM WAV files are supported", filePath)
+	}
+
+	frameSize := channels * bits / 8
+	frames := len(pcm) / frameSize
+	mono := make([]float32, frames)
+	for i := range mono {
+		var sum float32
+		for c := 0; c < channels; c++ {
+			offset := i * frameSize + c * bits / 8
+			if bits == 8 {
+				sum += (float32(pcm[offset]) - 128) / 128
+			} else {
+				sum += float32(int16(binary.LittleEndian.Uint16(pcm[offset:]))) / 32768
+			}
+		}
+		mono[i] = sum / float32(channels)
+	}
+	return resample(mono, rate, soundSampleRate), nil
+}
+
+//linear interpolation, good enough for the cabinet's sound effects
+func resample(samples []float32, from int, to int) []float32 {
+	if from == to || len(samples) == 0 {
+		return samples
+	}
+	out := make([]float32, int(int64(len(samples)) * int64(to) / int64(from)))
+	for i := range out {
+		pos := float64(i) * float64(from) / float64(to)
+		j := int(pos)
+		frac := float32(pos - float64(j))
+		next := samples[min(j + 1, len(samples) - 1)]
+		out[i] = samples[j] * (1 - frac) + next * frac
+	}
+	return out
+}
+
+//16-bit signed little endian, the format raylib and the WAV writer take
+func pcm16(samples []float32) []byte {
+	data := make([]byte, len(samples) * 2)
+	for i, sample := range samples {
+		sample = max(-1, min(1, sample))
+		binary.LittleEndian.PutUint16(data[i * 2:], uint16(int16(sample * 32767)))
+	}
+	return data
+}
+
+func writeWav(filePath string, samples []float32) error {
+	data := pcm16(samples)
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36 + len(data)))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) //PCM
+	binary.LittleEndian.PutUint16(header[22:], 1) //mono
+	binary.LittleEndian.PutUint32(header[24:], soundSampleRate)
+	binary.LittleEndian.PutUint32(header[28:], soundSampleRate * 2)
+	binary.LittleEndian.PutUint16(header[32:], 2)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(data)))
+
+	return os.WriteFile(filePath, append(header, data...), 0644)
+}
@@ -0,0 +1,209 @@
+//go:build !headless
+
+package main
+
+import (
+	"fmt"
+	"github.com/gen2brain/raylib-go/raylib"
+	"image/color"
+	"os"
+)
+
+//the raylib frontend: the window, keyboard and sound device. Building with -tags headless leaves it
+//out, so -headless and the tests build without cgo
+
+func (cpu *cpu) playSpaceInvaders() {
+	cpu.setupSpaceInvaders()
+
+	screenWidth, screenHeight := windowSize()
+	rl.InitWindow(screenWidth, screenHeight, "SPACE INVADERS (GO-8080 EMU)")
+	defer rl.CloseWindow()
+
+	//textures need the window's graphics context
+	var artwork *backdrop
+	if backdropPath != "" {
+		var err error
+		if artwork, err = loadBackdrop(backdropPath); err != nil {
+			fmt.Println("Could not load backdrop:", err)
+			cpu.exit(1)
+		}
+		defer artwork.unload()
+	}
+
+	rl.SetTargetFPS(60)
+
+	textureWidth := 224
+	textureHeight := 256
+	screenImage := rl.GenImageColor(int(textureWidth), int(textureHeight), rl.Black)
+	screenTexture := rl.LoadTextureFromImage(screenImage)
+	defer rl.UnloadTexture(screenTexture)
+	defer rl.UnloadImage(screenImage)
+
+	//buffer to hold the pixel data
+	pixelData := make([]color.RGBA, textureWidth*textureHeight)
+	cpu.framebuffer = pixelData
+
+	if !mute {
+		cpu.sound = newRaylibSound(loadSounds())
+		defer cpu.sound.close()
+	}
+
+	recorded := []frameInput{}
+	capture := &capture{}
+	for !rl.WindowShouldClose() {
+		rl.BeginDrawing()
+		rl.ClearBackground(rl.Black)
+
+		cpu.pollKeyboard()
+		if recordPath != "" {
+			recorded = append(recorded, frameInput{cpu.port1, cpu.port2})
+		}
+		cpu.runFrame()
+
+		var err error
+		if rl.IsKeyPressed(rl.KeyP) {
+			err = capture.screenshot(int(cpu.frames), pixelData)
+		}
+		if rl.IsKeyPressed(rl.KeyG) && err == nil {
+			err = capture.toggleGif(int(cpu.frames))
+		}
+		if err == nil {
+			err = capture.frame(int(cpu.frames), pixelData)
+		}
+		if err != nil {
+			fmt.Println("Could not capture frame:", err)
+		}
+
+		//update the texture with the new pixel data
+		rl.UpdateTexture(screenTexture, pixelData)
+
+		drawScreen(screenTexture, artwork)
+
+		if debug || fps {
+			rl.DrawFPS(0, 0)
+		}
+		if outputs {
+			cpu.drawOutputsPanel(int(screenHeight))
+		}
+
+		rl.EndDrawing()
+
+		if cpu.sound != nil {
+			cpu.sound.update(cpu.cycles)
+		}
+		if cpu.profile != nil {
+			cpu.profile.frames++
+		}
+	}
+
+	if err := capture.close(); err != nil {
+		fmt.Println("Could not capture frame:", err)
+	}
+	if recordPath != "" {
+		if err := os.WriteFile(recordPath, []byte(formatInputScript(recorded)), 0644); err != nil {
+			fmt.Println("Could not write recording:", err)
+		} else {
+			fmt.Println("Inputs recorded to:", recordPath)
+		}
+	}
+}
+
+//port 1 player 1 and port 2 player 2 input, read from the keyboard once per frame
+func (cpu *cpu) pollKeyboard() {
+	var input frameInput
+	if rl.IsKeyPressed(rl.KeyC) {      
+		input.port1 |= 0x01 //bit 0 = CREDIT (1 if deposit)
+	}
+	if rl.IsKeyPressed(rl.KeyV) {
+		input.port1 |= 0x02 //bit 1 = 2P start (1 if pressed)
+	}
+	if rl.IsKeyPressed(rl.KeyX) {       
+		input.port1 |= 0x04 //bit 2 = 1P start (1 if pressed)
+	}
+	if rl.IsKeyDown(rl.KeySpace) {        
+		input.port1 |= 0x10 //bit 4 = 1P shot (1 if pressed)
+	}
+	if rl.IsKeyDown(rl.KeyLeft) {        
+		input.port1 |= 0x20 //bit 5 = 1P left (1 if pressed)
+	}
+	if rl.IsKeyDown(rl.KeyRight) {       
+		input.port1 |= 0x40 //bit 6 = 1P right (1 if pressed)
+	}
+
+	if rl.IsKeyDown(rl.KeyT) {
+		input.port2 |= 0x04 //bit 2 = tilt
+	}
+	if rl.IsKeyDown(rl.KeyW) {
+		input.port2 |= 0x10 //bit 4 = 2P shot
+	}
+	if rl.IsKeyDown(rl.KeyA) {
+		input.port2 |= 0x20 //bit 5 = 2P left
+	}
+	if rl.IsKeyDown(rl.KeyD) {
+		input.port2 |= 0x40 //bit 6 = 2P right
+	}
+	cpu.setInputs(input)
+}
+
+//plays through the raylib audio device
+type raylibSound struct {
+	sounds [soundCount]rl.Sound
+	loaded [soundCount]bool
+	looping bool
+}
+
+func newRaylibSound(bank *soundBank) *raylibSound {
+	rl.InitAudioDevice()
+	player := &raylibSound{}
+	for sound, samples := range bank {
+		if samples == nil {
+			continue
+		}
+		wave := rl.NewWave(uint32(len(samples)), soundSampleRate, 16, 1, pcm16(samples))
+		player.sounds[sound] = rl.LoadSoundFromWave(wave)
+		player.loaded[sound] = true
+	}
+	return player
+}
+
+func (player *raylibSound) start(sound int, cycles uint64) {
+	if !player.loaded[sound] {
+		return
+	}
+	rl.PlaySound(player.sounds[sound])
+	if sound == soundUFO {
+		player.looping = true
+	}
+}
+
+func (player *raylibSound) stop(sound int, cycles uint64) {
+	if !player.loaded[sound] {
+		return
+	}
+	rl.StopSound(player.sounds[sound])
+	if sound == soundUFO {
+		player.looping = false
+	}
+}
+
+func (player *raylibSound) update(cycles uint64) {
+	if player.looping && !rl.IsSoundPlaying(player.sounds[soundUFO]) {
+		rl.PlaySound(player.sounds[soundUFO])
+	}
+}
+
+func (player *raylibSound) close() {
+	for sound := range player.sounds {
+		if player.loaded[sound] {
+			rl.UnloadSound(player.sounds[sound])
+		}
+	}
+	rl.CloseAudioDevice()
+}
+
+func (cpu *cpu) drawOutputsPanel(screenHeight int) {
+	lines := cpu.outputsPanel()
+	for i, line := range lines {
+		rl.DrawText(line, 2, int32(screenHeight - (len(lines) - i) * 12), 10, rl.Yellow)
+	}
+}
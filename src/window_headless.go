@@ -0,0 +1,13 @@
+//go:build headless
+
+package main
+
+import (
+	"fmt"
+)
+
+//built with -tags headless there is no raylib frontend, only -headless and the command line tools
+func (cpu *cpu) playSpaceInvaders() {
+	fmt.Println("Built without a window, run with -headless")
+	cpu.exit(1)
+}